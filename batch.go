@@ -0,0 +1,137 @@
+package bloomfilters
+
+import (
+	"errors"
+	"time"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// HashKBatch hashes many keys in one call, e.g. with SIMD instructions,
+// and returns their sums in order
+type HashKBatch = func(keys [][]byte) []uint64
+
+// batched counterparts of the built-in hash functions, keyed by the code
+// pointer of the function, see streamingHashes. Only package level functions
+// belong here: closures of one function literal share a code pointer
+// whatever they capture. Other functions get theirs through
+// Config.BatchHashes. SetMany() and TestMany() use them when available and
+// fall back to one call per key otherwise.
+var batchHashes = map[uintptr]HashKBatch{
+	funcPointer(Murmur3): Murmur3Batch,
+}
+
+// returns the batched counterpart of the n-th hash function h of the filter:
+// the one given in Config.BatchHashes, or else a built-in one
+func (b *Bloom) batchHash(n int, h hashK) (HashKBatch, bool) {
+	if n < len(b.batches) && b.batches[n] != nil {
+		return b.batches[n], true
+	}
+	batch, ok := batchHashes[funcPointer(h)]
+	return batch, ok
+}
+
+// reports whether batch returns the sums of h for all the probeInputs
+func sameBatchHash(h hashK, batch HashKBatch) bool {
+	var sums = batch(probeInputs)
+	if len(sums) != len(probeInputs) {
+		return false
+	}
+	for n, in := range probeInputs {
+		if h(in) != sums[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// returns Murmur3() of every key, in order, with a single allocation
+func Murmur3Batch(keys [][]byte) []uint64 {
+	var result = make([]uint64, len(keys))
+	for n, key := range keys {
+		result[n] = murmur3.Sum64(key)
+	}
+	return result
+}
+
+// same as calling Set() for each of keys, under a single lock
+func (b *Bloom) SetMany(keys [][]byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.hashCount() == 0 {
+		return errors.New("no hash function is defined")
+	}
+	// the bits of every key go to the store at once, see BatchBitStore
+	var masks = make(map[uint64]uint64)
+	var inserted uint64
+	for _, sums := range b.applyHashesBatch(keys) {
+		if b.addMasks(masks, sums) {
+			inserted++
+		}
+	}
+	if inserted == 0 {
+		return nil
+	}
+	setWords(b.bitsmap, masks)
+	b.version.Add(1)
+	b.totalEntriesCount.Add(inserted)
+	return nil
+}
+
+// same as calling Test() for each of keys, under a single lock
+func (b *Bloom) TestMany(keys [][]byte) []bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.hashCount() == 0 {
+		panic("no hash function is defined")
+	}
+	var indices = make([]IndexMap, len(keys))
+	for n, sums := range b.applyHashesBatch(keys) {
+		indices[n] = b.findIndexPair(sums)
+	}
+	// the words of every key are read at once, see BatchBitStore
+	var words = wordsOf(b.bitsmap, indices...)
+	var result = make([]bool, len(keys))
+	for n := range indices {
+		result[n] = assertBitsArray(words, indices[n])
+	}
+	return result
+}
+
+// it is the batched version of applyHashes(), returning the sums of
+// every key in order; empty keys get no sums, like in applyHashes()
+func (b *Bloom) applyHashesBatch(keys [][]byte) [][]uint64 {
+	var result = make([][]uint64, len(keys))
+	if b.doubleK > 0 || b.distinctBits > 0 {
+		for n, key := range keys {
+			result[n] = b.applyHashes(key)
+		}
+		return result
+	}
+	var salted = make([][]byte, 0, len(keys))
+	var owners = make([]int, 0, len(keys))
+	for n, key := range keys {
+		if len(key) > 0 {
+			result[n] = make([]uint64, len(b.k))
+			salted = append(salted, b.salted(key))
+			owners = append(owners, n)
+		}
+	}
+
+	for i, h := range b.k {
+		if batch, ok := b.batchHash(i, h); ok {
+			var start = time.Now()
+			for j, sum := range batch(salted) {
+				result[owners[j]][i] = sum
+			}
+			if b.timings != nil {
+				b.timings[i].Add(int64(time.Since(start)))
+			}
+			continue
+		}
+		for j, key := range salted {
+			result[owners[j]][i] = b.callHash(i, h, key)
+		}
+	}
+	return result
+}
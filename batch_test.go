@@ -0,0 +1,135 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// same output as Murmur3, but unknown to batchHashes
+func murmur3PerKey(b []byte) uint64 {
+	return Murmur3(b)
+}
+
+func batchKeys(n int) [][]byte {
+	var keys = make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	return keys
+}
+
+func TestSetMany_BatchedAndPerKey_MustProduceSameState(t *testing.T) {
+	var keys = batchKeys(1000)
+	keys = append(keys, []byte{})
+	m, _ := OptimalValues(1000, 0.01)
+
+	var batched = NewBloom(m, Fnv1, Murmur3)
+	var perKey = NewBloom(m, Fnv1, murmur3PerKey)
+	var single = NewBloom(m, Fnv1, Murmur3)
+	assert.NoError(t, batched.SetMany(keys))
+	assert.NoError(t, perKey.SetMany(keys))
+	for _, k := range keys {
+		assert.NoError(t, single.Set(k))
+	}
+
+	assert.Equal(t, single.bitsmap, batched.bitsmap)
+	assert.Equal(t, single.bitsmap, perKey.bitsmap)
+	assert.Equal(t, uint64(1000), batched.GetTotalInsertsCount())
+
+	var probes = append(batchKeys(2000), []byte{})
+	var results = batched.TestMany(probes)
+	for n, k := range probes {
+		assert.Equal(t, batched.Test(k), results[n])
+	}
+	assert.False(t, results[len(results)-1])
+}
+
+func TestSetMany_Salted_MustMatchSet(t *testing.T) {
+	var cfg = Config{Size: 64 * 64, Hashes: DefaultHashList, Salt: []byte("pepper")}
+	batched, err := NewBloomWithConfig(cfg)
+	assert.NoError(t, err)
+	single, err := NewBloomWithConfig(cfg)
+	assert.NoError(t, err)
+
+	var keys = batchKeys(50)
+	assert.NoError(t, batched.SetMany(keys))
+	for _, k := range keys {
+		assert.NoError(t, single.Set(k))
+	}
+	assert.Equal(t, single.bitsmap, batched.bitsmap)
+}
+
+// returns Murmur3 mixed with seed, and its batched counterpart;
+// all the closures of each literal share a code pointer
+func seededPair(seed uint64) (hashK, HashKBatch) {
+	var h = func(b []byte) uint64 {
+		return Murmur3(b) ^ seed
+	}
+	var batch = func(keys [][]byte) []uint64 {
+		var result = Murmur3Batch(keys)
+		for n := range result {
+			result[n] ^= seed
+		}
+		return result
+	}
+	return h, batch
+}
+
+func TestConfigBatchHashes_SeededClosures_MustUseTheirOwnBatch(t *testing.T) {
+	var keys = batchKeys(100)
+	var filters []*Bloom
+	for _, seed := range []uint64{1, 2} {
+		var h, batch = seededPair(seed)
+		var calls = 0
+		var counted = func(keys [][]byte) []uint64 {
+			calls++
+			return batch(keys)
+		}
+		bf, err := NewBloomWithConfig(Config{Size: 64 * 64, Hashes: []hashK{Fnv1, h}, BatchHashes: []HashKBatch{nil, counted}})
+		assert.NoError(t, err)
+		var single = NewBloom(64*64, Fnv1, h)
+		calls = 0
+
+		assert.NoError(t, bf.SetMany(keys))
+		for _, k := range keys {
+			assert.NoError(t, single.Set(k))
+		}
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, single.bitsmap, bf.bitsmap)
+		for _, k := range keys {
+			assert.True(t, bf.Test(k))
+		}
+		assert.Equal(t, single.TestMany(keys), bf.TestMany(keys))
+		assert.Equal(t, 2, calls)
+		filters = append(filters, bf)
+	}
+	assert.NotEqual(t, filters[0].bitsmap, filters[1].bitsmap)
+
+	// the batch of one seed for the hash of another is refused
+	var h1, _ = seededPair(1)
+	var _, batch2 = seededPair(2)
+	_, err := NewBloomWithConfig(Config{Size: 64 * 64, Hashes: []hashK{h1}, BatchHashes: []HashKBatch{batch2}})
+	assert.Error(t, err)
+	_, err = NewBloomWithConfig(Config{Size: 64 * 64, Hashes: []hashK{h1}, BatchHashes: []HashKBatch{nil, nil}})
+	assert.Error(t, err)
+}
+
+func benchmarkSetMany(b *testing.B, hashF ...hashK) {
+	m, _ := OptimalValues(100000, 0.001)
+	var bf = NewBloom(m, hashF...)
+	var keys = batchKeys(1000)
+
+	for b.Loop() {
+		bf.SetMany(keys)
+	}
+}
+
+func Benchmark_Bloom_SetMany_Batched(b *testing.B) {
+	benchmarkSetMany(b, Murmur3)
+}
+
+func Benchmark_Bloom_SetMany_PerKey(b *testing.B) {
+	benchmarkSetMany(b, murmur3PerKey)
+}
@@ -1,11 +1,18 @@
 package bloomfilters
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"math"
+	"math/bits"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/spaolacci/murmur3"
 )
@@ -24,8 +31,21 @@ type Bloom struct {
 	totalEntriesCount atomic.Uint64
 	size              uint64
 	bitsize           uint64
-	bitsmap           []uint64
+	bitsmap           BitStore
 	k                 []hashK
+	doubleK           int           // positions derived by double hashing instead of k, see NewBloomAuto()
+	distinctBits      int           // distinct positions derived from k[0], see NewBloomDistinctBits()
+	derived           []derivedHash // how the last len(derived) functions of k are derived, see ExtendHashesTo()
+	batches           []HashKBatch  // batched counterparts of k, see Config.BatchHashes
+	salt              []byte
+	probeErr          error
+	timings           []atomic.Int64 // per hash function, nil unless Config.InstrumentHashes
+
+	// bumped on every change to the bits, see EnableSnapshotReads()
+	version       atomic.Uint64
+	view          atomic.Pointer[readView]
+	refreshing    atomic.Bool
+	snapshotReads bool
 
 	lock *sync.RWMutex
 }
@@ -37,7 +57,7 @@ type Bloom struct {
 // n estimated number of items
 // p percentage of the false positive desired
 func OptimalValues(n uint64, p float64) (optimalBitArraySize uint64, optimalHashFuncCount uint64) {
-	m := (-1 * float64(n)) * math.Log(p) / float64(math.Pow(2.0, float64(math.Log(2))))
+	m := (-1 * float64(n)) * math.Log(p) / math.Pow(math.Log(2), 2)
 	cl := uint64(math.Ceil(m))
 	optimalBitArraySize = cl - (cl % 64)
 
@@ -47,6 +67,28 @@ func OptimalValues(n uint64, p float64) (optimalBitArraySize uint64, optimalHash
 	return
 }
 
+// returns the configuration of a ring of filters rotated every interval,
+// one filter (segment) per interval, which retains every item for at least
+// retention while keeping the false positive rate of a lookup across the
+// whole ring at p.
+// n estimated number of items inserted per interval
+//
+// it assumes a uniform insert rate. Right after a rotation the segment
+// being filled is empty, so one segment is added on top of the
+// retention/interval full ones. A lookup tests every segment, so each one
+// is sized for the rate 1 - (1-p)^(1/segments) rather than p.
+// It returns zeros unless both retention and interval are positive.
+func OptimalRotatingConfig(n uint64, p float64, retention, interval time.Duration) (segments int, perSegmentBits uint64, k uint64) {
+	if retention <= 0 || interval <= 0 {
+		return 0, 0, 0
+	}
+	segments = int((retention+interval-1)/interval) + 1
+	var segmentRate = 1 - math.Pow(1-p, 1/float64(segments))
+	// k is NaN for no item
+	perSegmentBits, k = OptimalValues(max(n, 1), segmentRate)
+	return
+}
+
 // size automatically rounds down to the nearest number divisible to 64
 // hashF a list of hash functions executed in the order they are added
 //
@@ -64,15 +106,313 @@ func NewBloom(size uint64, hashF ...hashK) *Bloom {
 	b.size = size / 64
 	b.bitsize = size
 
-	b.bitsmap = make([]uint64, size)
+	b.bitsmap = make(memoryStore, size)
 
 	b.k = hashF
+	b.probeErr = ProbeHashes(hashF...)
 
 	b.lock = &sync.RWMutex{}
 
 	return b
 }
 
+// Config holds the construction options of a filter, see NewBloomWithConfig()
+type Config struct {
+	// size of the bit array, rounded down to the nearest number divisible to 64
+	Size uint64
+	// hash functions executed in the order they are added
+	Hashes []hashK
+	// a secret prepended to every key before hashing. Without it, an attacker
+	// who knows the (public) hash functions can craft keys colliding with
+	// existing entries and force false positives. Keep it private; filters
+	// built with different salts have unrelated bit layouts.
+	Salt []byte
+	// records the time spent in each hash function, see HashTimings().
+	// It costs two clock reads per hash call, so it is off by default.
+	InstrumentHashes bool
+	// batched counterparts of Hashes, at the same indices, used by SetMany()
+	// and TestMany(), e.g. SIMD versions; nil entries, or missing ones at the
+	// end, hash one key at a time. Each must return the sums of its hash
+	// function, which is checked on a few inputs.
+	BatchHashes []HashKBatch
+}
+
+// same as NewBloom(), but takes its options from cfg and returns
+// an error instead of panicking on an invalid size
+func NewBloomWithConfig(cfg Config) (*Bloom, error) {
+	if cfg.Size < 64 {
+		return nil, errors.New("size cannot be less than 64")
+	}
+
+	if len(cfg.BatchHashes) > len(cfg.Hashes) {
+		return nil, errors.New("more batch hash functions than hash functions")
+	}
+	for n, batch := range cfg.BatchHashes {
+		if batch != nil && !sameBatchHash(cfg.Hashes[n], batch) {
+			return nil, fmt.Errorf("batch hash function #%d doesn't return the sums of its hash function", n)
+		}
+	}
+
+	var b = NewBloom(cfg.Size, cfg.Hashes...)
+
+	b.salt = bytes.Clone(cfg.Salt)
+	b.batches = slices.Clone(cfg.BatchHashes)
+
+	if cfg.InstrumentHashes {
+		b.timings = make([]atomic.Int64, len(b.k))
+	}
+
+	return b, nil
+}
+
+// builds a filter sized by OptimalValues() for n items at a false positive
+// rate of p, without the need to supply any hash function: the k positions
+// OptimalValues() recommends are all derived by double hashing from a single
+// 128-bit murmur3 sum, so a key is hashed once whatever k is.
+func NewBloomAuto(n uint64, p float64) *Bloom {
+	// k is NaN for no item
+	m, k := OptimalValues(max(n, 1), p)
+	var b = newBloomExact(max(m, 64))
+	b.doubleK = int(max(k, 1))
+	return b
+}
+
+// same as NewBloom(), but allocates exactly the size / 64 words the filter
+// is sized for instead of a word per bit; size must be at least 64
+func newBloomExact(size uint64, hashF ...hashK) *Bloom {
+	b, _ := NewBloomWithStore(make(memoryStore, size/64), hashF...)
+	return b
+}
+
+// builds the smallest filter OptimalValues() recommends for holding
+// mustContain at a false positive rate of p, and inserts every key of it.
+// If hashF has fewer functions than recommended, derived ones are added,
+// see ExtendHashesTo(); without any, positions are double hashed like in
+// NewBloomAuto(). Only presence is guaranteed, no key can be made to
+// test absent.
+func FitFilter(mustContain [][]byte, p float64, hashF []hashK) *Bloom {
+	m, k := OptimalValues(uint64(max(len(mustContain), 1)), p)
+	var b = newBloomExact(max(m, 64), hashF...)
+	if len(hashF) == 0 {
+		b.doubleK = int(max(k, 1))
+	} else {
+		b.ExtendHashesTo(int(k))
+	}
+	for _, d := range mustContain {
+		b.Set(d)
+	}
+	return b
+}
+
+// builds a filter in which every key sets exactly bits distinct bits,
+// which hashing alone doesn't guarantee: two positions of a key may land
+// on the same bit. Positions are double hashed from the single sum of
+// base, and one the key already has is rehashed until bits distinct ones
+// are found. While bits is small next to size, collisions are rare, about
+// bits^2 / (2 * size) per key, and so is the cost of the extra rounds.
+// It panics if bits is not between 1 and size.
+func NewBloomDistinctBits(size uint64, bits int, base hashK) *Bloom {
+	if size < 64 {
+		panic("size cannot be less than 64")
+	}
+	if base == nil {
+		panic("no hash function is defined")
+	}
+	var b = newBloomExact(size, base)
+	if bits < 1 || uint64(bits) > b.bitsize {
+		panic("bits must be between 1 and the size of the filter")
+	}
+	b.distinctBits = bits
+	return b
+}
+
+// returns the positions of a NewBloomDistinctBits() key whose base hash
+// sum is h, all of them below bitsize and distinct
+func (b *Bloom) distinctSums(h uint64) []uint64 {
+	var result = make([]uint64, 0, b.distinctBits)
+	var h1, h2 = h, fmix64(h) | 1
+	for i := uint64(0); len(result) < b.distinctBits; i++ {
+		var p = (h1 + i*h2) % b.bitsize
+		if slices.Contains(result, p) {
+			// h2 may share a factor with bitsize and cycle through
+			// a few positions only, so start over from another point
+			h1 = fmix64(h1 + i)
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// returns the number of bit positions each key sets
+func (b *Bloom) HashCount() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.hashCount()
+}
+
+// adds hash functions derived from the existing ones until there are k of
+// them, e.g. when OptimalValues() recommends more functions than supplied;
+// too few functions silently raise the false positive rate. It does nothing
+// if there are already k functions or none to derive from. Filters built by
+// NewBloomAuto() simply derive more positions from their double hashing.
+//
+// derived functions mix the outputs of pairs of existing ones, so they are
+// less independent than fresh hash functions would be, and keys sharing the
+// same base hash sums still collide in all of them. Call it before inserting
+// anything; entries inserted before don't have the bits of the new functions.
+// The number of bits of a NewBloomDistinctBits() filter never changes.
+func (b *Bloom) ExtendHashesTo(k int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.distinctBits > 0 {
+		return
+	}
+	if b.doubleK > 0 {
+		if k > b.doubleK {
+			b.doubleK = k
+			b.version.Add(1)
+		}
+		return
+	}
+	var n = len(b.k)
+	if n == 0 || n >= k {
+		return
+	}
+	// new slices, b.k and b.derived may share their arrays with the
+	// caller or a clone
+	var extended = make([]hashK, n, k)
+	copy(extended, b.k)
+	var derived = make([]derivedHash, len(b.derived), len(b.derived)+k-n)
+	copy(derived, b.derived)
+	for i := n; i < k; i++ {
+		var h = derivedHash{first: i % n, second: (i + 1) % n, seed: uint64(i) * 0x9e3779b97f4a7c15}
+		extended = append(extended, h.hash(b.k[h.first], b.k[h.second]))
+		derived = append(derived, h)
+	}
+	b.k = extended
+	b.derived = derived
+	b.version.Add(1)
+}
+
+// a hash function derived by ExtendHashesTo(), mixing the sums of
+// the functions first and second of the filter with a seed. Both come
+// before the one derived, so its sum can be computed from theirs, e.g.
+// when they are streamed, see applyHashesReader().
+type derivedHash struct {
+	first, second int
+	seed          uint64
+}
+
+func (h derivedHash) mix(first, second uint64) uint64 {
+	return fmix64((first ^ bits.RotateLeft64(second, 31)) + h.seed)
+}
+
+// returns the hash function mixing the outputs of h1 and h2
+func (h derivedHash) hash(h1, h2 hashK) hashK {
+	return func(d []byte) uint64 {
+		return h.mix(h1(d), h2(d))
+	}
+}
+
+// the murmur3 64-bit finalizer, every input bit affects every output bit
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+func (b *Bloom) hashCount() int {
+	if b.distinctBits > 0 {
+		return b.distinctBits
+	}
+	if b.doubleK > 0 {
+		return b.doubleK
+	}
+	return len(b.k)
+}
+
+// returns k sums of the form h1 + i*h2 (Kirsch-Mitzenmacher), which are
+// as good as k independent hashes for a bloom filter
+func doubleHashSums(h1, h2 uint64, k int) []uint64 {
+	// an odd step never cycles back to h1 early
+	h2 |= 1
+	var result = make([]uint64, k)
+	for i := range result {
+		result[i] = h1 + uint64(i)*h2
+	}
+	return result
+}
+
+// builds the largest filter whose bit array fits in maxBytes, its size
+// rounded down to the nearest number divisible to 64 bits. MaxItems(0.01)
+// tells how many items it holds at a 1% false positive rate.
+func NewBloomForBytes(maxBytes uint64, hashF ...hashK) *Bloom {
+	if maxBytes < 8 {
+		panic("size cannot be less than 64")
+	}
+	b, _ := NewBloomWithBuffer(make([]uint64, maxBytes/8), hashF...)
+	return b
+}
+
+// buf is adopted as the bit array of the filter and is zeroed on adoption,
+// so a buffer taken from a sync.Pool never leaks bits of a previous filter.
+// the size of the filter is len(buf) * 64 bits
+//
+// it lets callers which create and discard filters frequently recycle
+// the backing array instead of allocating a new one every time
+func NewBloomWithBuffer(buf []uint64, hashF ...hashK) (*Bloom, error) {
+	if len(buf) < 1 {
+		return nil, errors.New("buffer cannot be empty")
+	}
+
+	clear(buf)
+
+	return NewBloomWithStore(memoryStore(buf), hashF...)
+}
+
+var ErrConstantHash = errors.New("hash function returns the same value for distinct inputs")
+
+// distinct inputs fed to the hash functions by ProbeHashes()
+var probeInputs = [][]byte{
+	[]byte("a"),
+	[]byte("b"),
+	[]byte("probe"),
+	{0},
+	{0xff, 0xfe},
+	[]byte("the quick brown fox jumps over the lazy dog"),
+}
+
+// feeds a handful of distinct inputs through each hash function and returns
+// ErrConstantHash for the first one which maps all of them to the same value;
+// such a function sets the same bits for every key and makes the filter useless.
+// Constructors run it on the given functions, see HashProbe().
+func ProbeHashes(hashF ...hashK) error {
+	for n, h := range hashF {
+		var first = h(probeInputs[0])
+		var constant = true
+		for _, in := range probeInputs[1:] {
+			if h(in) != first {
+				constant = false
+				break
+			}
+		}
+		if constant {
+			return fmt.Errorf("%w: hash function #%d", ErrConstantHash, n)
+		}
+	}
+	return nil
+}
+
+// returns the result of ProbeHashes() for the hash functions the filter
+// was built with. It is a diagnostic only; the filter works regardless.
+func (b *Bloom) HashProbe() error {
+	return b.probeErr
+}
+
 // It returns, for each given integer (hash sum), the index array and the bit index
 // within the uint64 data value for that specific index.
 // the general forumla is simple: s / (n * b) where s is the given
@@ -84,14 +424,7 @@ func NewBloom(size uint64, hashF ...hashK) *Bloom {
 func (b *Bloom) findIndexPair(nums []uint64) IndexMap {
 	var result = make(IndexMap)
 	for _, index := range nums {
-		var bitIndex = index % 64
-		var mainIndex = (index - bitIndex)
-		if mainIndex > 0 {
-			mainIndex = mainIndex / 64
-		}
-		if mainIndex > 0 && mainIndex-1 > b.size {
-			mainIndex = mainIndex % b.size
-		}
+		mainIndex, bitIndex := b.locate(index)
 		if _, ok := result[mainIndex]; !ok {
 			result[mainIndex] = make([]BitIndex, 0, 1)
 		}
@@ -100,23 +433,68 @@ func (b *Bloom) findIndexPair(nums []uint64) IndexMap {
 	return result
 }
 
+// returns the index array and the bit index for a single hash sum,
+// see findIndexPair()
+func (b *Bloom) locate(sum uint64) (mainIndex uint64, bitIndex BitIndex) {
+	bitIndex = sum % 64
+	mainIndex = (sum - bitIndex)
+	if mainIndex > 0 {
+		mainIndex = mainIndex / 64
+	}
+	if mainIndex > 0 && mainIndex-1 > b.size {
+		mainIndex = mainIndex % b.size
+	}
+	// an adopted buffer has no spare words past size
+	if mainIndex >= b.bitsmap.Len() {
+		mainIndex = mainIndex % b.size
+	}
+	return
+}
+
+// returns the number of words locate() can map a sum to: the size words,
+// plus the two spare words past them which it doesn't wrap, when the bit
+// array holds them, like the one of NewBloom() does
+func (b *Bloom) reachableWords() uint64 {
+	return min(b.bitsmap.Len(), b.size+2)
+}
+
+// the insert counter is only incremented once all the bits of
+// the entry are set, and never for an entry which sets no bit
 func (b *Bloom) setBits(sums []uint64) error {
-	defer b.totalEntriesCount.Add(1)
-	var indicesPair = b.findIndexPair(sums)
-	for mainIndex, bitIndices := range indicesPair {
-		for _, bitIndex := range bitIndices {
-			// setting specific bit
-			b.bitsmap[mainIndex] |= (1 << bitIndex)
-		}
+	var masks = make(map[uint64]uint64, len(sums))
+	if !b.addMasks(masks, sums) {
+		return nil
 	}
+	setWords(b.bitsmap, masks)
+	b.version.Add(1)
+	b.totalEntriesCount.Add(1)
 	return nil
 }
 
+// adds to masks, word by word, the bits sums map to, and returns false
+// if there are none
+func (b *Bloom) addMasks(masks map[uint64]uint64, sums []uint64) bool {
+	for _, sum := range sums {
+		mainIndex, bitIndex := b.locate(sum)
+		// setting specific bit
+		masks[mainIndex] |= 1 << bitIndex
+	}
+	return len(sums) > 0
+}
+
 func (b *Bloom) applyHashes(d []byte) []uint64 {
 	if len(d) > 0 {
+		d = b.salted(d)
+		if b.doubleK > 0 {
+			h1, h2 := murmur3.Sum128(d)
+			return doubleHashSums(h1, h2, b.doubleK)
+		}
+		if b.distinctBits > 0 {
+			return b.distinctSums(b.callHash(0, b.k[0], d))
+		}
 		var result = make([]uint64, len(b.k))
 		for n, v := range b.k {
-			result[n] = v(d)
+			result[n] = b.callHash(n, v, d)
 		}
 		return result
 	}
@@ -124,10 +502,46 @@ func (b *Bloom) applyHashes(d []byte) []uint64 {
 	return nil
 }
 
+// calls the n-th hash function, recording its duration if instrumented
+func (b *Bloom) callHash(n int, h hashK, d []byte) uint64 {
+	if n >= len(b.timings) {
+		return h(d)
+	}
+	var start = time.Now()
+	var sum = h(d)
+	b.timings[n].Add(int64(time.Since(start)))
+	return sum
+}
+
+// returns the cumulative time spent in each hash function, in the order
+// they were added, or nil unless the filter was built with
+// Config.InstrumentHashes. Streamed values (SetReader) and functions
+// derived by ExtendHashesTo() are not timed.
+func (b *Bloom) HashTimings() []time.Duration {
+	if b.timings == nil {
+		return nil
+	}
+	var result = make([]time.Duration, len(b.timings))
+	for n := range b.timings {
+		result[n] = time.Duration(b.timings[n].Load())
+	}
+	return result
+}
+
+// returns d prefixed with the salt of the filter, if any
+func (b *Bloom) salted(d []byte) []byte {
+	if len(b.salt) == 0 {
+		return d
+	}
+	var r = make([]byte, 0, len(b.salt)+len(d))
+	r = append(r, b.salt...)
+	return append(r, d...)
+}
+
 func (b *Bloom) Set(d []byte) error {
 	b.lock.Lock()
 	defer b.lock.Unlock()
-	var numOfHashes = len(b.k)
+	var numOfHashes = b.hashCount()
 	if numOfHashes > 0 {
 		var err = b.setBits(b.applyHashes(d))
 		return err
@@ -136,29 +550,139 @@ func (b *Bloom) Set(d []byte) error {
 }
 
 func (b *Bloom) Test(d []byte) bool {
+	if v := b.currentView(); v != nil {
+		return b.testKey(v.bits, v.k, v.doubleK, d)
+	}
 	b.lock.RLock()
 	defer b.lock.RUnlock()
-	var numOfHashes = len(b.k)
+	var numOfHashes = b.hashCount()
 	if numOfHashes > 0 {
+		defer b.refreshView()
 		var hashes = b.applyHashes(d)
 		return b.testIfExists(hashes)
 	}
 	panic("no hash function is defined")
 }
 
+// same as Set(), but only the first n bytes of d are hashed, or all of d
+// if it is shorter; keys sharing that prefix are the same key to the filter
+func (b *Bloom) SetPrefix(d []byte, n int) error {
+	return b.Set(prefix(d, n))
+}
+
+// same as Test(), but only the first n bytes of d are hashed, see SetPrefix()
+func (b *Bloom) TestPrefix(d []byte, n int) bool {
+	return b.Test(prefix(d, n))
+}
+
+func prefix(d []byte, n int) []byte {
+	return d[:min(max(n, 0), len(d))]
+}
+
+// same as Set(), but the key is made of several parts, each hashed after
+// its length, so two ways of splitting the same bytes never collide:
+// ("a", "bc") and ("ab", "c") are different keys, whereas concatenating
+// them would give "abc" twice.
+func (b *Bloom) SetParts(parts ...[]byte) error {
+	return b.Set(frameParts(parts))
+}
+
+// same as Test(), but for a key made of several parts, see SetParts()
+func (b *Bloom) TestParts(parts ...[]byte) bool {
+	return b.Test(frameParts(parts))
+}
+
+// returns every part prefixed with its length as a uvarint
+func frameParts(parts [][]byte) []byte {
+	var size = 0
+	for _, p := range parts {
+		size += binary.MaxVarintLen64 + len(p)
+	}
+	var framed = make([]byte, 0, size)
+	for _, p := range parts {
+		framed = binary.AppendUvarint(framed, uint64(len(p)))
+		framed = append(framed, p...)
+	}
+	return framed
+}
+
+// same as Test(), but takes a string and hashes its bytes in place
+// instead of copying them into a []byte first. For unsalted filters whose
+// hash functions don't allocate (like DefaultHashList) a lookup makes no
+// allocation at all.
+//
+// the hash functions receive a []byte aliasing the memory of s, which Go
+// treats as immutable; they must only read it and never retain it past
+// the call, which holds for Fnv1, Murmur3 and any well-behaved hash.
+func (b *Bloom) TestString(s string) bool {
+	var d = unsafe.Slice(unsafe.StringData(s), len(s))
+	if v := b.currentView(); v != nil {
+		return b.testKey(v.bits, v.k, v.doubleK, d)
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.hashCount() > 0 {
+		defer b.refreshView()
+		return b.testKey(b.bitsmap, b.k, b.doubleK, d)
+	}
+	panic("no hash function is defined")
+}
+
+// same as applyHashes() followed by testIfExists(), without
+// building the intermediate slice and map. words and the hashing are
+// either those of the filter or those of a read view.
+func (b *Bloom) testKey(words BitStore, hashes []hashK, doubleK int, d []byte) bool {
+	if len(d) == 0 {
+		return false
+	}
+	// read views are in memory, only the filter's own store can batch
+	if _, ok := words.(BatchBitStore); ok {
+		return b.testIfExists(b.applyHashes(d))
+	}
+	d = b.salted(d)
+	if doubleK > 0 {
+		h1, h2 := murmur3.Sum128(d)
+		h2 |= 1
+		for i := range doubleK {
+			mainIndex, bitIndex := b.locate(h1 + uint64(i)*h2)
+			if (words.GetWord(mainIndex)>>bitIndex)&1 == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if b.distinctBits > 0 {
+		for _, sum := range b.distinctSums(b.callHash(0, hashes[0], d)) {
+			mainIndex, bitIndex := b.locate(sum)
+			if (words.GetWord(mainIndex)>>bitIndex)&1 == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for n, h := range hashes {
+		mainIndex, bitIndex := b.locate(b.callHash(n, h, d))
+		if (words.GetWord(mainIndex)>>bitIndex)&1 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (b *Bloom) testIfExists(sums []uint64) bool {
 	var indices = b.findIndexPair(sums)
-	return b.assertBitsArray(indices)
+	return assertBitsArray(wordsOf(b.bitsmap, indices), indices)
 }
 
-func (b *Bloom) assertBitsArray(indices IndexMap) bool {
+// words reads the words of indices, see wordsOf()
+func assertBitsArray(words func(uint64) uint64, indices IndexMap) bool {
 	var val uint64
 	if len(indices) == 0 {
 		return false
 	}
 	for mainIndex, bitIndices := range indices {
 		for _, bitIndex := range bitIndices {
-			val = (b.bitsmap[mainIndex] >> bitIndex) & 1
+			val = (words(mainIndex) >> bitIndex) & 1
 			if val == 0 {
 				return false
 			}
@@ -177,7 +701,7 @@ func (b *Bloom) checkBitsArray(indices IndexMap) (faultyIndices IndexMap, ok boo
 	}
 	for mainIndex, bitIndices := range indices {
 		for _, bitIndex := range bitIndices {
-			val = (b.bitsmap[mainIndex] >> bitIndex) & 1
+			val = (b.bitsmap.GetWord(mainIndex) >> bitIndex) & 1
 			if val == 0 {
 				if _, okk := faultyIndices[mainIndex]; !okk {
 					faultyIndices[mainIndex] = make([]BitIndex, 0, 1)
@@ -192,10 +716,173 @@ func (b *Bloom) checkBitsArray(indices IndexMap) (faultyIndices IndexMap, ok boo
 	return nil, true
 }
 
+// checks the internal invariants of the filter and returns the first
+// violated one, if any; useful after adopting a buffer or any manual
+// manipulation of the bit array.
+//
+// the bit array may hold more words than size, NewBloom() allocates
+// past it, but never fewer
+func (b *Bloom) Validate() error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.size < 1 {
+		return errors.New("size cannot be less than 1")
+	}
+	if b.bitsize != b.size*64 {
+		return fmt.Errorf("bitsize %d does not match size %d", b.bitsize, b.size)
+	}
+	if b.bitsmap.Len() < b.size {
+		return fmt.Errorf("bit array holds %d words, size is %d", b.bitsmap.Len(), b.size)
+	}
+	if b.hashCount() == 0 {
+		return errors.New("no hash function is defined")
+	}
+	return nil
+}
+
+// clears every bit and the insert counter. It takes the write lock, so it
+// never interleaves with a Set or Test in flight; a lookup answered from a
+// read view (EnableSnapshotReads()) before it stays consistent with the
+// state prior to the reset.
+func (b *Bloom) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.resetLocked()
+}
+
+// returns a copy of the filter and resets the filter itself, in one step
+// under the write lock, so every insert lands either in the returned copy or
+// in the reset filter; none is lost in between and none is counted twice.
+func (b *Bloom) SnapshotAndReset() *Bloom {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var snapshot = b.cloneLocked()
+	b.resetLocked()
+	return snapshot
+}
+
+// returns a deep copy of the filter; the caller must hold the lock
+func (b *Bloom) cloneLocked() *Bloom {
+	var c = &Bloom{
+		size:          b.size,
+		bitsize:       b.bitsize,
+		bitsmap:       cloneWords(b.bitsmap),
+		k:             b.k,
+		doubleK:       b.doubleK,
+		distinctBits:  b.distinctBits,
+		derived:       b.derived,
+		batches:       b.batches,
+		salt:          b.salt,
+		probeErr:      b.probeErr,
+		snapshotReads: b.snapshotReads,
+		lock:          &sync.RWMutex{},
+	}
+	c.totalEntriesCount.Store(b.totalEntriesCount.Load())
+	if b.timings != nil {
+		c.timings = make([]atomic.Int64, len(b.timings))
+	}
+	return c
+}
+
+// zeroes the bits and the insert counter; the caller must hold the write lock
+func (b *Bloom) resetLocked() {
+	b.bitsmap.Reset()
+	b.version.Add(1)
+	b.totalEntriesCount.Store(0)
+}
+
+// returns the number of entries inserted so far. It is safe to call
+// concurrently with Set and never decreases, except when Reset() or
+// SnapshotAndReset() zero it and when SetInsertCount() overrides it.
+// The counter is bumped only after the bits of an entry are set, so once
+// it reports N, the first N entries inserted since the last reset are
+// guaranteed to Test as present.
 func (b *Bloom) GetTotalInsertsCount() uint64 {
 	return b.totalEntriesCount.Load()
 }
 
+// overrides the insert counter with n, e.g. once the bits of the filter
+// were rebuilt or manipulated by hand and n is known from elsewhere, so the
+// estimates based on it, like EstimateFalsePositiveRate(), stay accurate.
+// The bits are left untouched.
+func (b *Bloom) SetInsertCount(n uint64) {
+	b.totalEntriesCount.Store(n)
+}
+
+// adds delta to the insert counter, stopping at the largest uint64 rather
+// than wrapping around; see SetInsertCount(). The bits are left untouched.
+func (b *Bloom) AddInsertCount(delta uint64) {
+	for {
+		var current = b.totalEntriesCount.Load()
+		var sum, carry = bits.Add64(current, delta, 0)
+		if carry != 0 {
+			sum = math.MaxUint64
+		}
+		if b.totalEntriesCount.CompareAndSwap(current, sum) {
+			return
+		}
+	}
+}
+
+// returns the false positive rate of a filter of m bits using k hash
+// functions once n items are inserted, using the community known formula
+// (1 - e^(-kn/m))^k. It needs no filter, which makes it handy for planning.
+func FalsePositiveProbability(m, k, n uint64) float64 {
+	if m == 0 {
+		return 1
+	}
+	return math.Pow(1-math.Exp(-float64(k)*float64(n)/float64(m)), float64(k))
+}
+
+// returns the false positive rate expected for the current number
+// of inserts, see FalsePositiveProbability()
+func (b *Bloom) EstimateFalsePositiveRate() float64 {
+	return FalsePositiveProbability(b.bitsize, uint64(b.HashCount()), b.GetTotalInsertsCount())
+}
+
+// returns how many more inserts are estimated before EstimateFalsePositiveRate()
+// reaches targetRate, given the current load and geometry of the filter.
+// A negative value means the rate is already exceeded by that many inserts.
+func (b *Bloom) InsertsUntilFPRate(targetRate float64) int64 {
+	var n = maxItems(b.bitsize, b.HashCount(), targetRate)
+	if n >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n) - int64(b.GetTotalInsertsCount())
+}
+
+// returns how many items the filter can hold in total before
+// EstimateFalsePositiveRate() exceeds p
+func (b *Bloom) MaxItems(p float64) uint64 {
+	var n = maxItems(b.bitsize, b.HashCount(), p)
+	if n >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(n)
+}
+
+// n = -m/k * ln(1 - p^(1/k)), FalsePositiveProbability() solved for n
+func maxItems(m uint64, k int, p float64) float64 {
+	if k == 0 || p >= 1 {
+		return math.Inf(1)
+	}
+	var kf = float64(k)
+	return -float64(m) / kf * math.Log(1-math.Pow(p, 1/kf))
+}
+
+// returns the number of bytes taken by the bit array. Note that NewBloom()
+// allocates a word per bit, while NewBloomWithBuffer() and NewBloomForBytes()
+// allocate exactly the words the filter is sized for. Stores with a
+// MemoryBytes() method report their own, like the one of SparseBloom.
+func (b *Bloom) MemoryBytes() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if m, ok := b.bitsmap.(interface{ MemoryBytes() uint64 }); ok {
+		return m.MemoryBytes()
+	}
+	return b.bitsmap.Len() * 8
+}
+
 func assertBits(value uint64, index BitIndex, expected uint64) bool {
 	var current = (value >> index) & 1
 	return current == expected
@@ -208,9 +895,7 @@ func Fnv1(b []byte) uint64 {
 }
 
 func Murmur3(b []byte) uint64 {
-	f := murmur3.New64()
-	f.Write(b)
-	return f.Sum64()
+	return murmur3.Sum64(b)
 }
 
 var DefaultHashList = make([]hashK, 0)
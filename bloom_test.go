@@ -2,102 +2,121 @@ package bloomfilters
 
 import (
 	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/spaolacci/murmur3"
 	"github.com/tjarratt/babble"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestBitIndexSimple_MustAssertTrue(t *testing.T) {
-	var bf = NewBloom(64, func(b []byte) uint64 {
-		return 1
-	})
-	bf.setBits([]uint64{0, 3, 5})
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		var bf = newBloomOnStore(newStore, 64, func(b []byte) uint64 {
+			return 1
+		})
+		bf.setBits([]uint64{0, 3, 5})
 
-	fmt.Printf("%064b", bf.bitsmap[0])
-	assert.True(t, assertBits(bf.bitsmap[0], 0, 1))
-	assert.True(t, assertBits(bf.bitsmap[0], 3, 1))
-	assert.True(t, assertBits(bf.bitsmap[0], 5, 1))
-	assert.True(t, assertBits(bf.bitsmap[0], 6, 0))
+		fmt.Printf("%064b", bf.bitsmap.GetWord(0))
+		assert.True(t, assertBits(bf.bitsmap.GetWord(0), 0, 1))
+		assert.True(t, assertBits(bf.bitsmap.GetWord(0), 3, 1))
+		assert.True(t, assertBits(bf.bitsmap.GetWord(0), 5, 1))
+		assert.True(t, assertBits(bf.bitsmap.GetWord(0), 6, 0))
+	})
 }
 
 func TestBitIndex_MultipleIndices_MustAssertTrue(t *testing.T) {
-	var bf = NewBloom(64, func(b []byte) uint64 {
-		return 1
-	})
-	bf.setBits([]uint64{0, 3, 5, 800})
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		var bf = newBloomOnStore(newStore, 64, func(b []byte) uint64 {
+			return 1
+		})
+		bf.setBits([]uint64{0, 3, 5, 800})
 
-	fmt.Printf("%064b", bf.bitsmap[0])
-	assert.True(t, bf.testIfExists([]uint64{0, 3, 5}))
-	failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{0, 3, 5, 800}))
-	assert.Empty(t, failedIndices)
-	assert.True(t, ok)
+		fmt.Printf("%064b", bf.bitsmap.GetWord(0))
+		assert.True(t, bf.testIfExists([]uint64{0, 3, 5}))
+		failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{0, 3, 5, 800}))
+		assert.Empty(t, failedIndices)
+		assert.True(t, ok)
+	})
 }
 
 func TestBitIndex_MultipleIndices_MustFail(t *testing.T) {
-	var bf = NewBloom(64, func(b []byte) uint64 {
-		return 1
-	})
-	bf.setBits([]uint64{0, 3, 5, 800})
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		var bf = newBloomOnStore(newStore, 64, func(b []byte) uint64 {
+			return 1
+		})
+		bf.setBits([]uint64{0, 3, 5, 800})
 
-	fmt.Printf("%064b", bf.bitsmap[0])
-	assert.True(t, bf.testIfExists([]uint64{0, 3, 5}))
-	failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{55, 3, 5, 801}))
-	assert.NotEmpty(t, failedIndices)
-	assert.False(t, ok)
-	if len(failedIndices) > 0 {
-		assert.Contains(t, failedIndices, uint64(0))
-		assert.Contains(t, failedIndices[0], uint64(55)) // for 55
-		assert.Contains(t, failedIndices[0], uint64(33)) // for 801
-	}
+		fmt.Printf("%064b", bf.bitsmap.GetWord(0))
+		assert.True(t, bf.testIfExists([]uint64{0, 3, 5}))
+		failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{55, 3, 5, 801}))
+		assert.NotEmpty(t, failedIndices)
+		assert.False(t, ok)
+		if len(failedIndices) > 0 {
+			assert.Contains(t, failedIndices, uint64(0))
+			assert.Contains(t, failedIndices[0], uint64(55)) // for 55
+			assert.Contains(t, failedIndices[0], uint64(33)) // for 801
+		}
+	})
 }
 
 func TestBitIndex_BigArray_MustAssertTrue(t *testing.T) {
-	var bf = NewBloom(64*1000, func(b []byte) uint64 {
-		return 1
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		var bf = newBloomOnStore(newStore, 64*1000, func(b []byte) uint64 {
+			return 1
+		})
+		bf.setBits([]uint64{64*1000 + 32})
+		failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{64*1000 + 32}))
+		assert.Empty(t, failedIndices)
+		assert.True(t, ok)
+		fmt.Printf("%064b", bf.bitsmap.GetWord(1000))
+		var n = uint64(0)
+		n = bf.bitsmap.GetWord(1000) >> 32 & 1
+		assert.Equal(t, uint64(1), n)
 	})
-	bf.setBits([]uint64{64*1000 + 32})
-	failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{64*1000 + 32}))
-	assert.Empty(t, failedIndices)
-	assert.True(t, ok)
-	fmt.Printf("%064b", bf.bitsmap[1000])
-	var n = uint64(0)
-	n = bf.bitsmap[1000] >> 32 & 1
-	assert.Equal(t, uint64(1), n)
 }
 
 func TestBitIndex_BigArray_MustFail(t *testing.T) {
-	var bf = NewBloom(64*1000, func(b []byte) uint64 {
-		return 1
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		var bf = newBloomOnStore(newStore, 64*1000, func(b []byte) uint64 {
+			return 1
+		})
+		bf.setBits([]uint64{64*1000 + 32})
+		failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{64*1000 + 33}))
+		assert.NotEmpty(t, failedIndices)
+		assert.False(t, ok)
+		fmt.Printf("%064b", bf.bitsmap.GetWord(1000))
+		var n = uint64(0)
+		n = bf.bitsmap.GetWord(1000) >> 32 & 1
+		assert.Equal(t, uint64(1), n)
+		n = uint64(0)
+		n = bf.bitsmap.GetWord(1000) >> 33 & 1
+		assert.Equal(t, uint64(0), n)
 	})
-	bf.setBits([]uint64{64*1000 + 32})
-	failedIndices, ok := bf.checkBitsArray(bf.findIndexPair([]uint64{64*1000 + 33}))
-	assert.NotEmpty(t, failedIndices)
-	assert.False(t, ok)
-	fmt.Printf("%064b", bf.bitsmap[1000])
-	var n = uint64(0)
-	n = bf.bitsmap[1000] >> 32 & 1
-	assert.Equal(t, uint64(1), n)
-	n = uint64(0)
-	n = bf.bitsmap[1000] >> 33 & 1
-	assert.Equal(t, uint64(0), n)
 }
 
 func Test_RealWorld_Usage(t *testing.T) {
-	m, k := OptimalValues(100000, 0.001)
-	assert.NotZero(t, m)
-	assert.NotZero(t, k)
-	var bf = NewBloom(m, DefaultHashList...)
-	assert.NoError(t, bf.Set([]byte("Hello")))
-	assert.NoError(t, bf.Set([]byte("Bob")))
-	assert.NoError(t, bf.Set([]byte("Sam")))
-	assert.True(t, bf.Test([]byte("Hello")))
-	assert.True(t, bf.Test([]byte("Bob")))
-	assert.True(t, bf.Test([]byte("Sam")))
-	assert.False(t, bf.Test([]byte("Joe")))
+	forEachStore(t, func(t *testing.T, newStore storeFactory) {
+		m, k := OptimalValues(100000, 0.001)
+		assert.NotZero(t, m)
+		assert.NotZero(t, k)
+		var bf = newBloomOnStore(newStore, m, DefaultHashList...)
+		assert.NoError(t, bf.Set([]byte("Hello")))
+		assert.NoError(t, bf.Set([]byte("Bob")))
+		assert.NoError(t, bf.Set([]byte("Sam")))
+		assert.True(t, bf.Test([]byte("Hello")))
+		assert.True(t, bf.Test([]byte("Bob")))
+		assert.True(t, bf.Test([]byte("Sam")))
+		assert.False(t, bf.Test([]byte("Joe")))
 
-	assert.Equal(t, uint64(3), bf.GetTotalInsertsCount())
+		assert.Equal(t, uint64(3), bf.GetTotalInsertsCount())
+	})
 }
 
 func Benchmark_Bloom_BigInsertion(b *testing.B) {
@@ -111,3 +130,712 @@ func Benchmark_Bloom_BigInsertion(b *testing.B) {
 		bf.Test([]byte(w))
 	}
 }
+
+func TestNewBloomWithBuffer_EmptyBuffer_MustFail(t *testing.T) {
+	bf, err := NewBloomWithBuffer(nil, DefaultHashList...)
+	assert.Error(t, err)
+	assert.Nil(t, bf)
+}
+
+func TestNewBloomWithBuffer_RecycledBuffer_MustNotLeakBits(t *testing.T) {
+	var buf = make([]uint64, 16)
+
+	bf, err := NewBloomWithBuffer(buf, DefaultHashList...)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(16*64), bf.bitsize)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.NoError(t, bf.Set([]byte("Bob")))
+	assert.True(t, bf.Test([]byte("Hello")))
+
+	// the second filter adopts the very same backing array
+	bf2, err := NewBloomWithBuffer(buf, DefaultHashList...)
+	assert.NoError(t, err)
+	for _, w := range buf {
+		assert.Zero(t, w)
+	}
+	assert.False(t, bf2.Test([]byte("Hello")))
+	assert.False(t, bf2.Test([]byte("Bob")))
+	assert.NoError(t, bf2.Set([]byte("Sam")))
+	assert.True(t, bf2.Test([]byte("Sam")))
+}
+
+func TestNewBloomWithBuffer_IndexPastSize_MustWrap(t *testing.T) {
+	bf, err := NewBloomWithBuffer(make([]uint64, 2), func(b []byte) uint64 {
+		return 2*64 + 3
+	})
+	assert.NoError(t, err)
+	assert.NotPanics(t, func() { bf.Set([]byte("Hello")) })
+	assert.True(t, bf.Test([]byte("Hello")))
+}
+
+func TestGetTotalInsertsCount_EmptyKey_MustNotCount(t *testing.T) {
+	var bf = NewBloom(64*16, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte{}))
+	assert.Equal(t, uint64(0), bf.GetTotalInsertsCount())
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.Equal(t, uint64(1), bf.GetTotalInsertsCount())
+}
+
+func TestGetTotalInsertsCount_Concurrent_MustBeConsistentWithTest(t *testing.T) {
+	const total = 2000
+	m, _ := OptimalValues(total, 0.001)
+	var bf = NewBloom(m, DefaultHashList...)
+	var keys = make([][]byte, total)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, k := range keys {
+			bf.Set(k)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for {
+				var n = bf.GetTotalInsertsCount()
+				assert.GreaterOrEqual(t, n, last)
+				last = n
+				for _, k := range keys[:n] {
+					if !bf.Test(k) {
+						t.Errorf("counter reported %d inserts but %q tests absent", n, k)
+						return
+					}
+				}
+				if n == total {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	<-done
+}
+
+func TestNewBloomWithConfig_InvalidSize_MustFail(t *testing.T) {
+	bf, err := NewBloomWithConfig(Config{Size: 63, Hashes: DefaultHashList})
+	assert.Error(t, err)
+	assert.Nil(t, bf)
+}
+
+func TestSalt_SameKey_MustMapToDifferentPositions(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.01)
+	bf1, err := NewBloomWithConfig(Config{Size: m, Hashes: DefaultHashList, Salt: []byte("pepper-1")})
+	assert.NoError(t, err)
+	bf2, err := NewBloomWithConfig(Config{Size: m, Hashes: DefaultHashList, Salt: []byte("pepper-2")})
+	assert.NoError(t, err)
+	var plain = NewBloom(m, DefaultHashList...)
+
+	var key = []byte("Hello")
+	assert.NotEqual(t, bf1.findIndexPair(bf1.applyHashes(key)), bf2.findIndexPair(bf2.applyHashes(key)))
+	assert.NotEqual(t, bf1.findIndexPair(bf1.applyHashes(key)), plain.findIndexPair(plain.applyHashes(key)))
+
+	assert.NoError(t, bf1.Set(key))
+	assert.True(t, bf1.Test(key))
+	assert.False(t, bf2.Test(key))
+}
+
+func TestEstimateFalsePositiveRate_MustGrowWithInserts(t *testing.T) {
+	var bf = NewBloom(64*16, DefaultHashList...)
+	assert.Zero(t, bf.EstimateFalsePositiveRate())
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	var r1 = bf.EstimateFalsePositiveRate()
+	assert.NoError(t, bf.Set([]byte("Bob")))
+	assert.Greater(t, bf.EstimateFalsePositiveRate(), r1)
+}
+
+func TestSetInsertCount_MustDriveEstimates(t *testing.T) {
+	var bf = NewBloom(64*16, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	var bitsBefore = cloneWords(bf.bitsmap)
+
+	bf.SetInsertCount(100)
+	assert.Equal(t, uint64(100), bf.GetTotalInsertsCount())
+	assert.Equal(t, FalsePositiveProbability(bf.bitsize, 2, 100), bf.EstimateFalsePositiveRate())
+	bf.AddInsertCount(20)
+	assert.Equal(t, uint64(120), bf.GetTotalInsertsCount())
+	assert.Equal(t, FalsePositiveProbability(bf.bitsize, 2, 120), bf.EstimateFalsePositiveRate())
+	bf.SetInsertCount(0)
+	assert.Zero(t, bf.EstimateFalsePositiveRate())
+	assert.Equal(t, bitsBefore, cloneWords(bf.bitsmap))
+
+	bf.SetInsertCount(math.MaxUint64 - 1)
+	bf.AddInsertCount(5)
+	assert.Equal(t, uint64(math.MaxUint64), bf.GetTotalInsertsCount())
+}
+
+func TestInsertsUntilFPRate_AfterPredictedInserts_MustReachTarget(t *testing.T) {
+	m, _ := OptimalValues(10000, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+	var target = 0.05
+
+	var remaining = bf.InsertsUntilFPRate(target)
+	assert.Positive(t, remaining)
+	for i := int64(0); i < remaining; i++ {
+		assert.NoError(t, bf.Set([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.InDelta(t, target, bf.EstimateFalsePositiveRate(), target*0.01)
+	assert.LessOrEqual(t, bf.InsertsUntilFPRate(target), int64(0))
+
+	for i := int64(0); i < 100; i++ {
+		assert.NoError(t, bf.Set([]byte(fmt.Sprintf("extra-%d", i))))
+	}
+	assert.Negative(t, bf.InsertsUntilFPRate(target))
+}
+
+func TestTestString_MustMatchTest(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.NoError(t, bf.Set([]byte("Bob")))
+	assert.True(t, bf.TestString("Hello"))
+	assert.True(t, bf.TestString("Bob"))
+	assert.False(t, bf.TestString("Joe"))
+	assert.False(t, bf.TestString(""))
+	for i := 0; i < 1000; i++ {
+		var w = fmt.Sprintf("word-%d", i)
+		assert.Equal(t, bf.Test([]byte(w)), bf.TestString(w))
+	}
+}
+
+func TestTestString_MustNotAllocate(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	var allocs = testing.AllocsPerRun(100, func() {
+		bf.TestString("Hello")
+		bf.TestString("Joe")
+	})
+	assert.Zero(t, allocs)
+}
+
+func Benchmark_Bloom_TestString(b *testing.B) {
+	m, _ := OptimalValues(100000, 0.001)
+	var bf = NewBloom(m, DefaultHashList...)
+	bf.Set([]byte("Hello"))
+	b.ReportAllocs()
+
+	for b.Loop() {
+		bf.TestString("Hello")
+	}
+}
+
+func Benchmark_Bloom_TestBytesConversion(b *testing.B) {
+	m, _ := OptimalValues(100000, 0.001)
+	var bf = NewBloom(m, DefaultHashList...)
+	bf.Set([]byte("Hello"))
+	var s = "Hello"
+	b.ReportAllocs()
+
+	for b.Loop() {
+		bf.Test([]byte(s))
+	}
+}
+
+func TestProbeHashes_ConstantHash_MustBeFlagged(t *testing.T) {
+	var constant = func(b []byte) uint64 {
+		return 1
+	}
+	assert.NoError(t, ProbeHashes(Fnv1))
+	assert.NoError(t, ProbeHashes(DefaultHashList...))
+
+	var err = ProbeHashes(Fnv1, constant)
+	assert.ErrorIs(t, err, ErrConstantHash)
+	assert.Contains(t, err.Error(), "#1")
+
+	var bf = NewBloom(64, constant)
+	assert.ErrorIs(t, bf.HashProbe(), ErrConstantHash)
+	assert.NoError(t, NewBloom(64, DefaultHashList...).HashProbe())
+}
+
+func TestValidate_MustCatchEachInvariant(t *testing.T) {
+	var build = func() *Bloom {
+		bf, err := NewBloomWithBuffer(make([]uint64, 4), DefaultHashList...)
+		assert.NoError(t, err)
+		return bf
+	}
+	assert.NoError(t, build().Validate())
+	assert.NoError(t, NewBloom(64*4, DefaultHashList...).Validate())
+
+	var bf = build()
+	bf.size = 0
+	assert.ErrorContains(t, bf.Validate(), "size cannot be less than 1")
+
+	bf = build()
+	bf.bitsize = 100
+	assert.ErrorContains(t, bf.Validate(), "bitsize")
+
+	bf = build()
+	bf.bitsmap = make(memoryStore, 3)
+	assert.ErrorContains(t, bf.Validate(), "bit array")
+
+	bf = build()
+	bf.k = nil
+	assert.ErrorContains(t, bf.Validate(), "no hash function")
+}
+
+func TestOptimalRotatingConfig_MustMeetRetention(t *testing.T) {
+	var retention = 90 * time.Minute
+	var interval = 20 * time.Minute
+	segments, bits, k := OptimalRotatingConfig(100000, 0.01, retention, interval)
+	assert.Equal(t, 6, segments)
+	// the oldest segment is dropped at rotation, the rest must cover retention
+	assert.GreaterOrEqual(t, time.Duration(segments-1)*interval, retention)
+
+	var segmentRate = 1 - math.Pow(1-0.01, 1/float64(segments))
+	wantBits, wantK := OptimalValues(100000, segmentRate)
+	assert.Equal(t, wantBits, bits)
+	assert.Equal(t, wantK, k)
+
+	// a lookup across the whole ring keeps the requested rate
+	assert.InDelta(t, 0.01, 1-math.Pow(1-segmentRate, float64(segments)), 1e-9)
+}
+
+func TestOptimalRotatingConfig_InvalidInterval_MustReturnZero(t *testing.T) {
+	segments, bits, k := OptimalRotatingConfig(100000, 0.01, time.Hour, 0)
+	assert.Zero(t, segments)
+	assert.Zero(t, bits)
+	assert.Zero(t, k)
+}
+
+func TestOptimalRotatingConfig_NoItem_MustSizeForOne(t *testing.T) {
+	segments, bits, k := OptimalRotatingConfig(0, 0.01, time.Hour, 20*time.Minute)
+	wantSegments, wantBits, wantK := OptimalRotatingConfig(1, 0.01, time.Hour, 20*time.Minute)
+	assert.Equal(t, wantSegments, segments)
+	assert.Equal(t, wantBits, bits)
+	assert.Equal(t, wantK, k)
+	assert.Less(t, k, uint64(100))
+}
+
+func TestOptimalRotatingConfig_InvalidRetention_MustReturnZero(t *testing.T) {
+	for _, retention := range []time.Duration{0, -time.Minute, -time.Hour} {
+		segments, bits, k := OptimalRotatingConfig(100000, 0.01, retention, 20*time.Minute)
+		assert.Zero(t, segments)
+		assert.Zero(t, bits)
+		assert.Zero(t, k)
+	}
+}
+
+func TestOptimalValues_MustMatchKnownValues(t *testing.T) {
+	// m = -n ln(p) / ln(2)^2, k = m/n ln(2)
+	m, k := OptimalValues(100000, 0.01)
+	assert.Equal(t, uint64(958464), m)
+	assert.Equal(t, uint64(7), k)
+}
+
+func TestNewBloomAuto_MustReachFalsePositiveRate(t *testing.T) {
+	var bf = NewBloomAuto(100000, 0.01)
+	assert.Equal(t, 7, bf.HashCount())
+	assert.NoError(t, bf.HashProbe())
+	assert.NoError(t, bf.Validate())
+
+	for i := 0; i < 100000; i++ {
+		assert.NoError(t, bf.Set([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	for i := 0; i < 100000; i++ {
+		if !bf.Test([]byte(fmt.Sprintf("key-%d", i))) {
+			t.Fatalf("key-%d must test present", i)
+		}
+	}
+
+	var falsePositives = 0
+	for i := 0; i < 100000; i++ {
+		if bf.Test([]byte(fmt.Sprintf("absent-%d", i))) {
+			falsePositives++
+		}
+	}
+	var rate = float64(falsePositives) / 100000
+	assert.Less(t, rate, 0.01*1.5)
+	assert.InDelta(t, 0.01, bf.EstimateFalsePositiveRate(), 0.001)
+}
+
+func TestNewBloomAuto_MustAllocateExactSize(t *testing.T) {
+	var bf = NewBloomAuto(100000, 0.01)
+	m, _ := OptimalValues(100000, 0.01)
+	assert.Equal(t, m/8, bf.MemoryBytes())
+	assert.NoError(t, bf.Validate())
+
+	var empty = NewBloomAuto(0, 0.01)
+	assert.Equal(t, uint64(64/8), empty.MemoryBytes())
+	assert.GreaterOrEqual(t, empty.HashCount(), 1)
+	assert.NoError(t, empty.Set([]byte("Hello")))
+	assert.True(t, empty.Test([]byte("Hello")))
+}
+
+func TestNewBloomAuto_AllPaths_MustAgree(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.01)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.NoError(t, bf.SetMany([][]byte{[]byte("Bob"), []byte("Sam")}))
+	assert.NoError(t, bf.SetReader(strings.NewReader("Joe")))
+	assert.Equal(t, uint64(4), bf.GetTotalInsertsCount())
+
+	for _, k := range []string{"Hello", "Bob", "Sam", "Joe"} {
+		assert.True(t, bf.Test([]byte(k)))
+		assert.True(t, bf.TestString(k))
+		assert.True(t, bf.TestReader(strings.NewReader(k)))
+	}
+	assert.Equal(t, []bool{true, false}, bf.TestMany([][]byte{[]byte("Sam"), []byte("Alice")}))
+	assert.False(t, bf.TestString("Alice"))
+}
+
+func TestFitFilter_MustHoldKeysAtOptimalSize(t *testing.T) {
+	var keys = make([][]byte, 5000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	m, k := OptimalValues(5000, 0.01)
+
+	for _, hashF := range [][]hashK{DefaultHashList, nil} {
+		var bf = FitFilter(keys, 0.01, hashF)
+		assert.Equal(t, m, bf.bitsize)
+		assert.Equal(t, m/8, bf.MemoryBytes())
+		assert.Equal(t, int(k), bf.HashCount())
+		assert.Equal(t, uint64(len(keys)), bf.GetTotalInsertsCount())
+		for _, d := range keys {
+			if !bf.Test(d) {
+				t.Fatalf("%s must test present", d)
+			}
+		}
+		assert.InDelta(t, 0.01, bf.EstimateFalsePositiveRate(), 0.001)
+	}
+
+	// no key still makes a usable filter
+	var empty = FitFilter(nil, 0.01, DefaultHashList)
+	assert.NoError(t, empty.Validate())
+	assert.False(t, empty.Test([]byte("Hello")))
+}
+
+// returns the number of set bits of the filter
+func setBitCount(b *Bloom) int {
+	var count = 0
+	for _, w := range cloneWords(b.bitsmap) {
+		count += bits.OnesCount64(w)
+	}
+	return count
+}
+
+func TestNewBloomDistinctBits_EveryInsert_MustSetExactlyBits(t *testing.T) {
+	var bf = NewBloomDistinctBits(64*2+10, 8, Murmur3)
+	assert.Equal(t, uint64(64*2), bf.bitsize)
+	assert.Equal(t, uint64(2*8), bf.MemoryBytes())
+	assert.Equal(t, 8, bf.HashCount())
+	assert.Equal(t, DistinctHashing, bf.HashStrategy())
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.Equal(t, 8, setBitCount(bf))
+	assert.True(t, bf.Test([]byte("Hello")))
+
+	// in 128 bits, 48 positions collide for nearly every key, unless
+	// they are kept distinct
+	var dense = NewBloomDistinctBits(64*2, 48, Murmur3)
+	for i := 0; i < 100; i++ {
+		dense.Reset()
+		assert.NoError(t, dense.Set([]byte(fmt.Sprintf("key-%d", i))))
+		assert.Equal(t, 48, setBitCount(dense))
+	}
+
+	var full = NewBloomDistinctBits(64, 64, Murmur3)
+	assert.NoError(t, full.Set([]byte("Hello")))
+	assert.Equal(t, 64, setBitCount(full))
+	full.ExtendHashesTo(100)
+	assert.Equal(t, 64, full.HashCount())
+}
+
+func TestNewBloomDistinctBits_AllPaths_MustAgree(t *testing.T) {
+	var bf = NewBloomDistinctBits(64*64, 7, Murmur3)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.NoError(t, bf.SetMany([][]byte{[]byte("Bob"), []byte("Sam")}))
+	assert.NoError(t, bf.SetReader(strings.NewReader("Joe")))
+	assert.Equal(t, 4*7, setBitCount(bf))
+
+	for _, k := range []string{"Hello", "Bob", "Sam", "Joe"} {
+		assert.True(t, bf.Test([]byte(k)))
+		assert.True(t, bf.TestString(k))
+		assert.True(t, bf.TestReader(strings.NewReader(k)))
+	}
+	assert.Equal(t, []bool{true, false}, bf.TestMany([][]byte{[]byte("Sam"), []byte("Alice")}))
+	assert.False(t, bf.TestString("Alice"))
+	assert.True(t, bf.SnapshotAndReset().Test([]byte("Sam")))
+	assert.ErrorIs(t, CompatibilityHandshake(bf, NewBloomDistinctBits(64*64, 8, Murmur3)), ErrHashCountMismatch)
+	assert.ErrorIs(t, CompatibilityHandshake(bf, NewBloomForBytes(64*64/8, Murmur3)), ErrStrategyMismatch)
+}
+
+func TestNewBloomDistinctBits_InvalidBits_MustPanic(t *testing.T) {
+	assert.Panics(t, func() { NewBloomDistinctBits(64, 0, Murmur3) })
+	assert.Panics(t, func() { NewBloomDistinctBits(64, 65, Murmur3) })
+	assert.Panics(t, func() { NewBloomDistinctBits(64, 8, nil) })
+	assert.Panics(t, func() { NewBloomDistinctBits(63, 1, Murmur3) })
+}
+
+func TestFalsePositiveProbability_MustMatchKnownValues(t *testing.T) {
+	// 10 bits per item with 7 hash functions
+	assert.InDelta(t, 0.00819, FalsePositiveProbability(1000, 7, 100), 0.00001)
+	assert.InDelta(t, 0.0174, FalsePositiveProbability(1000, 3, 100), 0.0001)
+	assert.Zero(t, FalsePositiveProbability(1000, 7, 0))
+	assert.Equal(t, float64(1), FalsePositiveProbability(0, 7, 100))
+
+	for _, p := range []float64{0.1, 0.01, 0.001} {
+		m, k := OptimalValues(100000, p)
+		assert.InDelta(t, p, FalsePositiveProbability(m, k, 100000), p*0.2)
+	}
+}
+
+func TestHashTimings_SlowHash_MustDominate(t *testing.T) {
+	var slow = func(b []byte) uint64 {
+		time.Sleep(time.Millisecond)
+		return Murmur3(b)
+	}
+	bf, err := NewBloomWithConfig(Config{Size: 64 * 64, Hashes: []hashK{Fnv1, slow}, InstrumentHashes: true})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		var key = []byte(fmt.Sprintf("key-%d", i))
+		assert.NoError(t, bf.Set(key))
+		assert.True(t, bf.Test(key))
+		assert.True(t, bf.TestString(string(key)))
+	}
+	assert.NoError(t, bf.SetMany([][]byte{[]byte("Hello")}))
+
+	var timings = bf.HashTimings()
+	assert.Len(t, timings, 2)
+	assert.GreaterOrEqual(t, timings[1], 31*time.Millisecond)
+	assert.Less(t, timings[0]*10, timings[1])
+
+	assert.Nil(t, NewBloom(64, DefaultHashList...).HashTimings())
+}
+
+func TestNewBloomForBytes_MustFitBudget(t *testing.T) {
+	for _, budget := range []uint64{8, 100, 4096, 1 << 20} {
+		var bf = NewBloomForBytes(budget, DefaultHashList...)
+		assert.LessOrEqual(t, bf.MemoryBytes(), budget)
+		assert.Greater(t, bf.MemoryBytes()+8, budget)
+		assert.NoError(t, bf.Validate())
+	}
+	assert.Panics(t, func() { NewBloomForBytes(7, DefaultHashList...) })
+
+	var bf = NewBloomForBytes(1<<20, DefaultHashList...)
+	var capacity = bf.MaxItems(0.01)
+	assert.Positive(t, capacity)
+	assert.InDelta(t, 0.01, FalsePositiveProbability(bf.bitsize, 2, capacity), 0.0001)
+}
+
+func TestSnapshotAndReset_MustMoveStateToSnapshot(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.001)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+
+	var snapshot = bf.SnapshotAndReset()
+	assert.True(t, snapshot.Test([]byte("Hello")))
+	assert.Equal(t, uint64(1), snapshot.GetTotalInsertsCount())
+	assert.False(t, bf.Test([]byte("Hello")))
+	assert.Zero(t, bf.GetTotalInsertsCount())
+
+	// the two no longer share bits
+	assert.NoError(t, bf.Set([]byte("Bob")))
+	assert.False(t, snapshot.Test([]byte("Bob")))
+}
+
+func TestSnapshotAndReset_ConcurrentInserts_MustLoseNothing(t *testing.T) {
+	const writers, perWriter = 4, 2000
+	var bf = NewBloomAuto(writers*perWriter, 0.0001)
+	bf.EnableSnapshotReads()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				assert.NoError(t, bf.Set([]byte(fmt.Sprintf("key-%d-%d", w, i))))
+			}
+		}()
+	}
+	var snapshots []*Bloom
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		snapshots = append(snapshots, bf.SnapshotAndReset())
+	}
+	wg.Wait()
+	snapshots = append(snapshots, bf)
+
+	var total uint64
+	for _, s := range snapshots {
+		total += s.GetTotalInsertsCount()
+	}
+	assert.Equal(t, uint64(writers*perWriter), total)
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			var key = []byte(fmt.Sprintf("key-%d-%d", w, i))
+			if !TestAcross(snapshots, key, Any) {
+				t.Fatalf("%s was lost", key)
+			}
+		}
+	}
+}
+
+func TestExtendHashesTo_MustImproveFalsePositiveRate(t *testing.T) {
+	var seeded = func(b []byte) uint64 {
+		return murmur3.Sum64WithSeed(b, 42)
+	}
+	var measure = func(bf *Bloom) float64 {
+		for i := 0; i < 20000; i++ {
+			assert.NoError(t, bf.Set([]byte(fmt.Sprintf("key-%d", i))))
+		}
+		var falsePositives = 0
+		for i := 0; i < 50000; i++ {
+			if bf.Test([]byte(fmt.Sprintf("absent-%d", i))) {
+				falsePositives++
+			}
+		}
+		return float64(falsePositives) / 50000
+	}
+
+	// 10 bits per item, for which 7 functions are optimal
+	var three = NewBloomForBytes(200000/8, Fnv1, Murmur3, seeded)
+	var seven = NewBloomForBytes(200000/8, Fnv1, Murmur3, seeded)
+	seven.ExtendHashesTo(7)
+	assert.Equal(t, 3, three.HashCount())
+	assert.Equal(t, 7, seven.HashCount())
+	assert.NoError(t, seven.HashProbe())
+	assert.NoError(t, ProbeHashes(seven.k...))
+
+	var threeRate, sevenRate = measure(three), measure(seven)
+	assert.Less(t, sevenRate, threeRate*0.75)
+
+	// never shrinks, and the caller's list is left alone
+	var list = append(make([]hashK, 0, 8), Fnv1, Murmur3)
+	var bf = NewBloom(64, list...)
+	bf.ExtendHashesTo(4)
+	bf.ExtendHashesTo(2)
+	assert.Equal(t, 4, bf.HashCount())
+	assert.Len(t, list, 2)
+	assert.Len(t, list[:3], 3)
+	assert.Nil(t, list[:3][2])
+}
+
+func TestExtendHashesTo_Auto_MustAddPositions(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.01)
+	bf.ExtendHashesTo(10)
+	assert.Equal(t, 10, bf.HashCount())
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.Len(t, bf.applyHashes([]byte("Hello")), 10)
+	assert.True(t, bf.Test([]byte("Hello")))
+}
+
+func TestSetParts_DifferentSplits_MustNotCollide(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.001)
+	assert.NoError(t, bf.SetParts([]byte("a"), []byte("bc")))
+
+	assert.True(t, bf.TestParts([]byte("a"), []byte("bc")))
+	assert.False(t, bf.TestParts([]byte("ab"), []byte("c")))
+	assert.False(t, bf.TestParts([]byte("abc")))
+	assert.False(t, bf.TestParts([]byte("a"), []byte("b"), []byte("c")))
+	assert.False(t, bf.Test([]byte("abc")))
+
+	// naive concatenation makes both splits the same key
+	assert.NoError(t, bf.Set(append([]byte("a"), "bc"...)))
+	assert.True(t, bf.Test(append([]byte("ab"), "c"...)))
+
+	// an empty part is still a part
+	assert.NoError(t, bf.SetParts([]byte("x"), nil))
+	assert.False(t, bf.TestParts([]byte("x")))
+	assert.True(t, bf.TestParts([]byte("x"), []byte{}))
+}
+
+func TestSetPrefix_SharedPrefix_MustCollide(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.001)
+	assert.NoError(t, bf.SetPrefix([]byte("/users/42/profile"), 9))
+
+	assert.True(t, bf.TestPrefix([]byte("/users/42/settings"), 9))
+	assert.True(t, bf.Test([]byte("/users/42")))
+	assert.False(t, bf.TestPrefix([]byte("/users/43/profile"), 9))
+	assert.False(t, bf.Test([]byte("/users/42/profile")))
+
+	// a prefix longer than the key is the whole key
+	assert.True(t, bf.TestPrefix([]byte("/users/42"), 100))
+	assert.False(t, bf.TestPrefix([]byte("/users/42"), -1))
+}
+
+func TestReset_MustClearBitsAndCounter(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.001)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	bf.Reset()
+	assert.False(t, bf.Test([]byte("Hello")))
+	assert.Zero(t, bf.GetTotalInsertsCount())
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.True(t, bf.Test([]byte("Hello")))
+}
+
+func TestReset_ConcurrentSetTest_MustStayConsistent(t *testing.T) {
+	var bf = NewBloomAuto(10000, 0.001)
+	bf.EnableSnapshotReads()
+
+	// resets begun and completed so far; an insert which starts once the
+	// last reset completed must survive, one which ends before it begins
+	// must not, and one in between may or may not
+	var begun, completed atomic.Int64
+	type insert struct {
+		key           []byte
+		before, after int64
+	}
+	var inserts = make([][]insert, 4)
+
+	var stop = make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range inserts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var key = []byte(fmt.Sprintf("key-%d-%d", w, i))
+				var many = []byte(fmt.Sprintf("many-%d-%d", w, i))
+				var before = completed.Load()
+				assert.NoError(t, bf.Set(key))
+				inserts[w] = append(inserts[w], insert{key, before, begun.Load()})
+				bf.Test(key)
+				bf.TestString(string(key))
+				before = completed.Load()
+				assert.NoError(t, bf.SetMany([][]byte{many}))
+				inserts[w] = append(inserts[w], insert{many, before, begun.Load()})
+			}
+		}()
+	}
+	const resets = 20
+	for i := 0; i < resets; i++ {
+		time.Sleep(time.Millisecond)
+		begun.Add(1)
+		bf.Reset()
+		completed.Add(1)
+	}
+	time.Sleep(5 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	var certain, uncertain uint64
+	for _, list := range inserts {
+		for _, in := range list {
+			switch {
+			case in.before == resets:
+				certain++
+				if !bf.Test(in.key) {
+					t.Fatalf("%s was inserted after the last reset and must test present", in.key)
+				}
+			case in.after == resets:
+				uncertain++
+			}
+		}
+	}
+	assert.Positive(t, certain)
+	assert.GreaterOrEqual(t, bf.GetTotalInsertsCount(), certain)
+	assert.LessOrEqual(t, bf.GetTotalInsertsCount(), certain+uncertain)
+}
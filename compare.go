@@ -0,0 +1,191 @@
+package bloomfilters
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+var ErrIncompatibleFilters = errors.New("filters are not compatible")
+
+var ErrSaturated = errors.New("every bit is set, the number of items can't be estimated")
+
+// the mismatches reported by CompatibilityHandshake(),
+// all of them are an ErrIncompatibleFilters
+var (
+	ErrSizeMismatch      = fmt.Errorf("%w: sizes differ", ErrIncompatibleFilters)
+	ErrStrategyMismatch  = fmt.Errorf("%w: hashing strategies differ", ErrIncompatibleFilters)
+	ErrHashCountMismatch = fmt.Errorf("%w: hash counts differ", ErrIncompatibleFilters)
+	ErrHashMismatch      = fmt.Errorf("%w: hash functions differ", ErrIncompatibleFilters)
+	ErrSaltMismatch      = fmt.Errorf("%w: salts differ", ErrIncompatibleFilters)
+)
+
+// returns nil if a and b are compatible, i.e. the same key sets the same
+// bits in both, so their bits can be merged or compared. Otherwise the
+// error names the first mismatch among size, hashing strategy, effective
+// number of hashes, hash functions and salt. It is cheap, and meant to be
+// checked before shipping the bits of a filter anywhere.
+//
+// hash functions are compared by their sums of the ProbeHashes() inputs,
+// not by identity: closures of the same function literal share their code,
+// but not their captured seeds. Functions differing on none of the inputs
+// are taken for the same.
+func CompatibilityHandshake(a, b *Bloom) error {
+	var unlock = rlockBoth(a, b)
+	defer unlock()
+	return compatibleLocked(a, b)
+}
+
+// see CompatibilityHandshake(); the caller must hold both read locks
+func compatibleLocked(a, b *Bloom) error {
+	if a.bitsize != b.bitsize {
+		return fmt.Errorf("%w: %d and %d bits", ErrSizeMismatch, a.bitsize, b.bitsize)
+	}
+	// indices past size only wrap where there are no spare words
+	if a.bitsmap.Len() != b.bitsmap.Len() {
+		return fmt.Errorf("%w: %d and %d words", ErrSizeMismatch, a.bitsmap.Len(), b.bitsmap.Len())
+	}
+	if a.hashStrategy() != b.hashStrategy() {
+		return ErrStrategyMismatch
+	}
+	if a.hashCount() != b.hashCount() {
+		return fmt.Errorf("%w: %d and %d", ErrHashCountMismatch, a.hashCount(), b.hashCount())
+	}
+	for n := range a.k {
+		if !sameHash(a.k[n], b.k[n]) {
+			return fmt.Errorf("%w: #%d", ErrHashMismatch, n)
+		}
+	}
+	if !bytes.Equal(a.salt, b.salt) {
+		return ErrSaltMismatch
+	}
+	return nil
+}
+
+// reports whether h1 and h2 return the same sums for all the probeInputs
+func sameHash(h1, h2 hashK) bool {
+	for _, in := range probeInputs {
+		if h1(in) != h2(in) {
+			return false
+		}
+	}
+	return true
+}
+
+// takes the read lock of both filters, always in the same order so two
+// calls with swapped arguments can't deadlock behind a waiting writer
+func rlockBoth(a, b *Bloom) (unlock func()) {
+	if a == b {
+		a.lock.RLock()
+		return a.lock.RUnlock
+	}
+	if uintptr(unsafe.Pointer(a)) > uintptr(unsafe.Pointer(b)) {
+		a, b = b, a
+	}
+	a.lock.RLock()
+	b.lock.RLock()
+	return func() {
+		b.lock.RUnlock()
+		a.lock.RUnlock()
+	}
+}
+
+// returns true if every bit set in other is also set in b, which means b
+// probably holds every item other does. The guarantee goes one way only:
+// it may report a superset which isn't one, due to false positives, but it
+// never denies a true superset. Filters must be compatible, otherwise
+// ErrIncompatibleFilters is returned.
+func (b *Bloom) ProbablyContains(other *Bloom) (bool, error) {
+	var unlock = rlockBoth(b, other)
+	defer unlock()
+	if err := compatibleLocked(b, other); err != nil {
+		return false, err
+	}
+	for i := range other.bitsmap.Len() {
+		if other.bitsmap.GetWord(i)&^b.bitsmap.GetWord(i) != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// how TestAcross() combines the answers of several filters
+type CombinePolicy int
+
+const (
+	// present in at least one of the filters
+	Any CombinePolicy = iota
+	// present in every one of the filters
+	All
+)
+
+// tests d against every filter and combines the answers with policy.
+// An empty list of filters holds nothing, under either policy.
+func TestAcross(filters []*Bloom, d []byte, policy CombinePolicy) bool {
+	if len(filters) == 0 {
+		return false
+	}
+	for _, f := range filters {
+		var present = f.Test(d)
+		if policy == Any && present {
+			return true
+		}
+		if policy == All && !present {
+			return false
+		}
+	}
+	return policy == All
+}
+
+// estimates |A ∩ B| for the items inserted in b and other. Each side is
+// estimated from its number of set bits, the union from the bits of
+// A | B, which by inclusion-exclusion is |A| + |B| - |A & B|, and then
+// |A ∩ B| = |A| + |B| - |A ∪ B|. The bits are counted over every word a
+// key can reach, spare ones included, see reachableWords(). Filters must
+// be compatible, otherwise ErrIncompatibleFilters is returned. Once every
+// bit of A | B is set, nothing can be told any more and ErrSaturated is
+// returned.
+func (b *Bloom) EstimateIntersectionCardinality(other *Bloom) (uint64, error) {
+	var unlock = rlockBoth(b, other)
+	defer unlock()
+	if err := compatibleLocked(b, other); err != nil {
+		return 0, err
+	}
+	// compatible filters have as many words, so as many reachable ones
+	var words = b.reachableWords()
+	var m = words * 64
+	var setA, setB, setBoth uint64
+	for i := range words {
+		var wordA, wordB = b.bitsmap.GetWord(i), other.bitsmap.GetWord(i)
+		setA += uint64(bits.OnesCount64(wordA))
+		setB += uint64(bits.OnesCount64(wordB))
+		setBoth += uint64(bits.OnesCount64(wordA & wordB))
+	}
+	// A or B saturated saturates A | B too
+	if setA+setB-setBoth >= m {
+		return 0, ErrSaturated
+	}
+	var k = b.hashCount()
+	var estimate = estimateCardinality(setA, m, k) +
+		estimateCardinality(setB, m, k) -
+		estimateCardinality(setA+setB-setBoth, m, k)
+	if estimate < 0 {
+		return 0, nil
+	}
+	return uint64(math.Round(estimate)), nil
+}
+
+// estimates the number of items inserted in a filter of m bits with k
+// hashes from its count of set bits: n = -m/k * ln(1 - setBits/m)
+func estimateCardinality(setBits, m uint64, k int) float64 {
+	if k == 0 {
+		return 0
+	}
+	if setBits >= m {
+		return math.Inf(1)
+	}
+	return -float64(m) / float64(k) * math.Log(1-float64(setBits)/float64(m))
+}
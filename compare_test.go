@@ -0,0 +1,191 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbablyContains_Superset_MustBeTrue(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.001)
+	var a = NewBloom(m, DefaultHashList...)
+	var b = NewBloom(m, DefaultHashList...)
+	for i := 0; i < 1000; i++ {
+		var key = []byte(fmt.Sprintf("key-%d", i))
+		assert.NoError(t, a.Set(key))
+		if i%2 == 0 {
+			assert.NoError(t, b.Set(key))
+		}
+	}
+
+	ok, err := a.ProbablyContains(b)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = a.ProbablyContains(a)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = b.ProbablyContains(a)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestProbablyContains_MissingKey_MustBeFalse(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.001)
+	var a = NewBloom(m, DefaultHashList...)
+	var b = NewBloom(m, DefaultHashList...)
+	assert.NoError(t, a.Set([]byte("Hello")))
+	assert.NoError(t, b.Set([]byte("Hello")))
+	assert.NoError(t, b.Set([]byte("Bob")))
+
+	ok, err := a.ProbablyContains(b)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestProbablyContains_Incompatible_MustFail(t *testing.T) {
+	var a = NewBloom(64*64, DefaultHashList...)
+
+	_, err := a.ProbablyContains(NewBloom(64*32, DefaultHashList...))
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+
+	_, err = a.ProbablyContains(NewBloom(64*64, Murmur3, Fnv1))
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+
+	salted, _ := NewBloomWithConfig(Config{Size: 64 * 64, Hashes: DefaultHashList, Salt: []byte("pepper")})
+	_, err = a.ProbablyContains(salted)
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+}
+
+func TestTestAcross_Policies(t *testing.T) {
+	var filters = []*Bloom{NewBloomAuto(100, 0.001), NewBloomAuto(100, 0.001), NewBloomAuto(100, 0.001)}
+	for _, f := range filters {
+		assert.NoError(t, f.Set([]byte("everywhere")))
+	}
+	assert.NoError(t, filters[1].Set([]byte("once")))
+
+	assert.True(t, TestAcross(filters, []byte("once"), Any))
+	assert.False(t, TestAcross(filters, []byte("once"), All))
+	assert.True(t, TestAcross(filters, []byte("everywhere"), Any))
+	assert.True(t, TestAcross(filters, []byte("everywhere"), All))
+	assert.False(t, TestAcross(filters, []byte("nowhere"), Any))
+	assert.False(t, TestAcross(nil, []byte("everywhere"), All))
+}
+
+// returns Murmur3 mixed with seed; every closure shares the code pointer
+func seededHash(seed uint64) hashK {
+	return func(b []byte) uint64 {
+		return Murmur3(b) ^ seed
+	}
+}
+
+func TestCompatibilityHandshake_ClosuresOfOneLiteral_MustCompareSeeds(t *testing.T) {
+	var a = NewBloom(64*64, Fnv1, seededHash(1))
+	var b = NewBloom(64*64, Fnv1, seededHash(2))
+	assert.Equal(t, funcPointer(a.k[1]), funcPointer(b.k[1]))
+	assert.ErrorIs(t, CompatibilityHandshake(a, b), ErrHashMismatch)
+	assert.NoError(t, CompatibilityHandshake(a, NewBloom(64*64, Fnv1, seededHash(1))))
+
+	assert.NoError(t, a.Set([]byte("Hello")))
+	_, err := b.ProbablyContains(a)
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+	_, err = b.EstimateIntersectionCardinality(a)
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+
+	// the same sums make the same bits, whatever the function
+	assert.NoError(t, CompatibilityHandshake(NewBloom(64*64, Murmur3), NewBloom(64*64, murmur3PerKey)))
+}
+
+func TestCompatibilityHandshake_MustNameEachMismatch(t *testing.T) {
+	var base = NewBloom(64*64, Fnv1, Murmur3)
+	assert.NoError(t, CompatibilityHandshake(base, NewBloom(64*64, Fnv1, Murmur3)))
+	assert.NoError(t, CompatibilityHandshake(base, base))
+	assert.NoError(t, CompatibilityHandshake(NewBloomAuto(1000, 0.01), NewBloomAuto(1000, 0.01)))
+
+	var salted, _ = NewBloomWithConfig(Config{Size: 64 * 64, Hashes: []hashK{Fnv1, Murmur3}, Salt: []byte("pepper")})
+	var auto = NewBloomAuto(1000, 0.01)
+	var direct = NewBloomForBytes(auto.MemoryBytes(), DefaultHashList...)
+	direct.ExtendHashesTo(auto.HashCount())
+
+	var cases = []struct {
+		other *Bloom
+		err   error
+	}{
+		{NewBloom(64*32, Fnv1, Murmur3), ErrSizeMismatch},
+		{NewBloom(64*64, Fnv1), ErrHashCountMismatch},
+		{NewBloom(64*64, Murmur3, Fnv1), ErrHashMismatch},
+		{salted, ErrSaltMismatch},
+	}
+	for _, c := range cases {
+		var err = CompatibilityHandshake(base, c.other)
+		assert.ErrorIs(t, err, c.err)
+		assert.ErrorIs(t, err, ErrIncompatibleFilters)
+	}
+	assert.ErrorIs(t, CompatibilityHandshake(auto, direct), ErrStrategyMismatch)
+	assert.ErrorContains(t, CompatibilityHandshake(base, NewBloom(64*32, Fnv1, Murmur3)), "4096 and 2048 bits")
+	assert.ErrorContains(t, CompatibilityHandshake(base, NewBloomForBytes(64*64/8, Fnv1, Murmur3)), "4096 and 64 words")
+}
+
+func TestEstimateIntersectionCardinality_Overlap_MustBeNear51(t *testing.T) {
+	var a = NewBloomAuto(1000, 0.001)
+	var b = NewBloomAuto(1000, 0.001)
+	for i := 1; i <= 150; i++ {
+		var key = []byte(fmt.Sprintf("key-%d", i))
+		if i <= 100 {
+			assert.NoError(t, a.Set(key))
+		}
+		if i >= 50 {
+			assert.NoError(t, b.Set(key))
+		}
+	}
+
+	n, err := a.EstimateIntersectionCardinality(b)
+	assert.NoError(t, err)
+	assert.InDelta(t, 51, float64(n), 5)
+
+	n, err = a.EstimateIntersectionCardinality(NewBloomAuto(1000, 0.001))
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = a.EstimateIntersectionCardinality(a)
+	assert.NoError(t, err)
+	assert.InDelta(t, 100, float64(n), 5)
+
+	_, err = a.EstimateIntersectionCardinality(NewBloomAuto(10, 0.001))
+	assert.ErrorIs(t, err, ErrIncompatibleFilters)
+}
+
+func TestEstimateIntersectionCardinality_BitsInSpareWord_MustCount(t *testing.T) {
+	var spare = func(b []byte) uint64 {
+		return 4*64 + 5
+	}
+	var a, b = NewBloom(64*4, spare), NewBloom(64*4, spare)
+	assert.NoError(t, a.Set([]byte("Hello")))
+	assert.NoError(t, b.Set([]byte("Hello")))
+
+	contains, err := a.ProbablyContains(b)
+	assert.NoError(t, err)
+	assert.True(t, contains)
+	n, err := a.EstimateIntersectionCardinality(b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), n)
+}
+
+func TestEstimateIntersectionCardinality_Saturated_MustFail(t *testing.T) {
+	var a = NewBloomForBytes(8*2, DefaultHashList...)
+	var b = NewBloomForBytes(8*2, DefaultHashList...)
+	a.bitsmap.SetBits(0, math.MaxUint64)
+	b.bitsmap.SetBits(1, math.MaxUint64)
+	// neither is saturated, but their union is
+	_, err := a.EstimateIntersectionCardinality(b)
+	assert.ErrorIs(t, err, ErrSaturated)
+
+	a.bitsmap.SetBits(1, math.MaxUint64)
+	_, err = a.EstimateIntersectionCardinality(b)
+	assert.ErrorIs(t, err, ErrSaturated)
+	_, err = a.EstimateIntersectionCardinality(a)
+	assert.ErrorIs(t, err, ErrSaturated)
+}
@@ -0,0 +1,40 @@
+package bloomfilters
+
+import "slices"
+
+// returns, for each word of the bit array which d touches, the current value
+// of that word masked to just the bits of d. Diffing the footprints of a key
+// on two nodes shows exactly which bits they disagree on.
+func (b *Bloom) KeyFootprint(d []byte) map[uint64]uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var result = make(map[uint64]uint64)
+	for mainIndex, bitIndices := range b.findIndexPair(b.applyHashes(d)) {
+		var mask uint64
+		for _, bitIndex := range bitIndices {
+			mask |= 1 << bitIndex
+		}
+		result[mainIndex] = b.bitsmap.GetWord(mainIndex) & mask
+	}
+	return result
+}
+
+// returns the sorted global positions (word*64 + bit) of the bits d maps to,
+// if d tests present, or nil. For a false positive these are the bits other
+// inserts have set between them; the KeyFootprint() of the inserted keys
+// tells which of them set which bit.
+func (b *Bloom) ExplainFalsePositive(d []byte) []uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var sums = b.applyHashes(d)
+	if !b.testIfExists(sums) {
+		return nil
+	}
+	var positions = make([]uint64, 0, len(sums))
+	for _, sum := range sums {
+		mainIndex, bitIndex := b.locate(sum)
+		positions = append(positions, mainIndex*64+bitIndex)
+	}
+	slices.Sort(positions)
+	return slices.Compact(positions)
+}
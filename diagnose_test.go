@@ -0,0 +1,49 @@
+package bloomfilters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyFootprint_MustShowKeyBits(t *testing.T) {
+	var first = func(b []byte) uint64 {
+		return 1
+	}
+	var second = func(b []byte) uint64 {
+		if string(b) == "a" {
+			return 64 + 6
+		}
+		return 2*64 + 2
+	}
+	var bf = NewBloom(64*4, first, second)
+	assert.NoError(t, bf.Set([]byte("a")))
+
+	assert.Equal(t, map[uint64]uint64{0: 1 << 1, 1: 1 << 6}, bf.KeyFootprint([]byte("a")))
+	// "b" shares the first word with "a", but its bit in word 2 is unset
+	assert.Equal(t, map[uint64]uint64{0: 1 << 1, 2: 0}, bf.KeyFootprint([]byte("b")))
+	assert.Empty(t, bf.KeyFootprint(nil))
+}
+
+func TestExplainFalsePositive_MustReturnCollidingBits(t *testing.T) {
+	var positions = map[string][2]uint64{
+		"a": {1, 64 + 6},
+		"b": {2*64 + 2, 64 + 6},
+		// never inserted, but both its bits are set by "a" and "b"
+		"c": {2*64 + 2, 1},
+		"d": {1, 3},
+	}
+	var first = func(b []byte) uint64 {
+		return positions[string(b)][0]
+	}
+	var second = func(b []byte) uint64 {
+		return positions[string(b)][1]
+	}
+	var bf = NewBloom(64*4, first, second)
+	assert.NoError(t, bf.Set([]byte("a")))
+	assert.NoError(t, bf.Set([]byte("b")))
+
+	assert.Equal(t, []uint64{1, 2*64 + 2}, bf.ExplainFalsePositive([]byte("c")))
+	assert.Equal(t, []uint64{1, 64 + 6}, bf.ExplainFalsePositive([]byte("a")))
+	assert.Nil(t, bf.ExplainFalsePositive([]byte("d")))
+}
@@ -0,0 +1,71 @@
+package bloomfilters
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// how many keys LoadSorted() reads between two progress reports
+const progressInterval = 10000
+
+// reads newline-delimited keys from r, which must be sorted, and inserts
+// them. Consecutive duplicates are adjacent in a sorted stream, so they are
+// skipped by a plain comparison instead of being hashed again. Empty lines
+// are skipped as well. progress, if not nil, is periodically called with
+// the number of keys read so far, and once more at the end.
+// It returns the number of keys inserted.
+func (b *Bloom) LoadSorted(r io.Reader, progress func(done uint64)) (uint64, error) {
+	var scanner = bufio.NewScanner(r)
+	var previous []byte
+	var read, inserted uint64
+	for scanner.Scan() {
+		var key = scanner.Bytes()
+		read++
+		if len(key) > 0 && (previous == nil || !bytes.Equal(key, previous)) {
+			if err := b.Set(key); err != nil {
+				return inserted, err
+			}
+			inserted++
+			// the scanner reuses its buffer
+			previous = append(previous[:0], key...)
+		}
+		if progress != nil && read%progressInterval == 0 {
+			progress(read)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return inserted, err
+	}
+	if progress != nil {
+		progress(read)
+	}
+	return inserted, nil
+}
+
+// reads newline-delimited candidate keys from candidates and writes to novel,
+// one per line, every key which tests absent in the filter. The filter has no
+// false negatives, so every key written is definitely not in it, whereas a
+// few new keys may be held back by false positives. Empty lines are skipped.
+// It returns the number of keys written.
+func (b *Bloom) DiffLines(candidates io.Reader, novel io.Writer) (novelCount uint64, err error) {
+	var scanner = bufio.NewScanner(candidates)
+	var w = bufio.NewWriter(novel)
+	for scanner.Scan() {
+		var key = scanner.Bytes()
+		if len(key) == 0 || b.Test(key) {
+			continue
+		}
+		if _, err = w.Write(key); err != nil {
+			return novelCount, err
+		}
+		if err = w.WriteByte('\n'); err != nil {
+			return novelCount, err
+		}
+		novelCount++
+	}
+	if err = scanner.Err(); err != nil {
+		return novelCount, err
+	}
+	return novelCount, w.Flush()
+}
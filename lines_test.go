@@ -0,0 +1,82 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSorted_DuplicateRuns_MustInsertDistinctKeys(t *testing.T) {
+	var stream strings.Builder
+	var lines uint64
+	for i := 0; i < 5000; i++ {
+		// every key comes in a run of 1 to 3 copies
+		for j := 0; j <= i%3; j++ {
+			fmt.Fprintf(&stream, "key-%05d\n", i)
+			lines++
+		}
+	}
+	m, _ := OptimalValues(5000, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+
+	var reports []uint64
+	inserted, err := bf.LoadSorted(strings.NewReader(stream.String()), func(done uint64) {
+		reports = append(reports, done)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5000), inserted)
+	assert.Equal(t, uint64(5000), bf.GetTotalInsertsCount())
+	assert.Equal(t, []uint64{lines}, reports)
+	for i := 0; i < 5000; i++ {
+		assert.True(t, bf.Test([]byte(fmt.Sprintf("key-%05d", i))))
+	}
+}
+
+func TestLoadSorted_EmptyLines_MustBeSkipped(t *testing.T) {
+	var bf = NewBloom(64*64, DefaultHashList...)
+	inserted, err := bf.LoadSorted(strings.NewReader("\na\na\n\nb"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), inserted)
+	assert.True(t, bf.Test([]byte("a")))
+	assert.True(t, bf.Test([]byte("b")))
+}
+
+func TestLoadSorted_LongStream_MustReportPeriodically(t *testing.T) {
+	var stream strings.Builder
+	for i := 0; i < 2*progressInterval+5; i++ {
+		fmt.Fprintf(&stream, "key-%06d\n", i)
+	}
+	m, _ := OptimalValues(2*progressInterval, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+
+	var reports []uint64
+	_, err := bf.LoadSorted(strings.NewReader(stream.String()), func(done uint64) {
+		reports = append(reports, done)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{progressInterval, 2 * progressInterval, 2*progressInterval + 5}, reports)
+}
+
+func TestDiffLines_HalfInserted_MustReportOtherHalf(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.0001)
+	var candidates strings.Builder
+	var expected strings.Builder
+	for i := 0; i < 1000; i++ {
+		var key = fmt.Sprintf("key-%d", i)
+		fmt.Fprintln(&candidates, key)
+		if i%2 == 0 {
+			assert.NoError(t, bf.Set([]byte(key)))
+		} else {
+			fmt.Fprintln(&expected, key)
+		}
+	}
+	candidates.WriteString("\n")
+
+	var novel strings.Builder
+	count, err := bf.DiffLines(strings.NewReader(candidates.String()), &novel)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(500), count)
+	assert.Equal(t, expected.String(), novel.String())
+}
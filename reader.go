@@ -0,0 +1,117 @@
+package bloomfilters
+
+import (
+	"errors"
+	"hash"
+	"hash/fnv"
+	"io"
+	"reflect"
+
+	"github.com/spaolacci/murmur3"
+)
+
+var ErrNotStreamable = errors.New("hash function cannot hash a stream")
+
+// streaming counterparts of the built-in hash functions, keyed by the
+// code pointer of the function. A hashK is an opaque function, so this
+// is how we know a hasher with the very same output exists for it.
+var streamingHashes = map[uintptr]func() hash.Hash64{
+	funcPointer(Fnv1):    fnv.New64,
+	funcPointer(Murmur3): murmur3.New64,
+}
+
+func funcPointer(f hashK) uintptr {
+	return reflect.ValueOf(f).Pointer()
+}
+
+// same as Set(), but the value is streamed from r into the hash functions
+// instead of being loaded into memory first; useful for large blobs.
+// Only hash functions with a streaming counterpart (Fnv1 and Murmur3)
+// are supported, ErrNotStreamable is returned otherwise; functions added by
+// ExtendHashesTo() are derived from the supported ones. Filters built by
+// NewBloomAuto() always support it.
+func (b *Bloom) SetReader(r io.Reader) error {
+	b.lock.RLock()
+	var hashes, derived, doubleK = b.k, b.derived, b.doubleK
+	b.lock.RUnlock()
+	if len(hashes) == 0 && doubleK == 0 {
+		return errors.New("no hash function is defined")
+	}
+	// hashing happens outside of the lock, reading r can take long
+	sums, err := b.applyHashesReader(r, hashes, derived, doubleK)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.setBits(sums)
+}
+
+// same as Test(), but the value is streamed from r, see SetReader().
+// It returns false if r cannot be read or cannot be hashed as a stream.
+func (b *Bloom) TestReader(r io.Reader) bool {
+	b.lock.RLock()
+	var hashes, derived, doubleK = b.k, b.derived, b.doubleK
+	b.lock.RUnlock()
+	if len(hashes) == 0 && doubleK == 0 {
+		panic("no hash function is defined")
+	}
+	sums, err := b.applyHashesReader(r, hashes, derived, doubleK)
+	if err != nil {
+		return false
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.testIfExists(sums)
+}
+
+// it is the streaming version of applyHashes(), which feeds r
+// to every hash function at once as it is read. hashes, derived and doubleK
+// are those of the filter, read under the lock by the caller; the last
+// len(derived) hashes are not streamed but derived from the sums of others.
+func (b *Bloom) applyHashesReader(r io.Reader, hashes []hashK, derived []derivedHash, doubleK int) ([]uint64, error) {
+	if doubleK > 0 {
+		var h = murmur3.New128()
+		h.Write(b.salt)
+		written, err := io.Copy(h, r)
+		if err != nil || written == 0 {
+			return nil, err
+		}
+		h1, h2 := h.Sum128()
+		return doubleHashSums(h1, h2, doubleK), nil
+	}
+
+	var base = hashes[:len(hashes)-len(derived)]
+	var hashers = make([]hash.Hash64, len(base))
+	var writers = make([]io.Writer, len(base))
+	for n, f := range base {
+		newHasher, ok := streamingHashes[funcPointer(f)]
+		if !ok {
+			return nil, ErrNotStreamable
+		}
+		hashers[n] = newHasher()
+		writers[n] = hashers[n]
+	}
+
+	var w = io.MultiWriter(writers...)
+	w.Write(b.salt)
+	written, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if written == 0 {
+		return nil, nil
+	}
+
+	var result = make([]uint64, len(hashers), len(hashes))
+	for n, h := range hashers {
+		result[n] = h.Sum64()
+	}
+	for _, h := range derived {
+		result = append(result, h.mix(result[h.first], result[h.second]))
+	}
+	if b.distinctBits > 0 {
+		return b.distinctSums(result[0]), nil
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package bloomfilters
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetReader_LargeValue_MustMatchBytePath(t *testing.T) {
+	m, _ := OptimalValues(1000, 0.01)
+	var bf = NewBloom(m, DefaultHashList...)
+	var value = bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+
+	assert.NoError(t, bf.SetReader(bytes.NewReader(value)))
+	assert.True(t, bf.TestReader(bytes.NewReader(value)))
+	assert.True(t, bf.Test(value))
+	sums, err := bf.applyHashesReader(bytes.NewReader(value), bf.k, bf.derived, bf.doubleK)
+	assert.NoError(t, err)
+	assert.Equal(t, bf.applyHashes(value), sums)
+
+	value[0] = 'x'
+	assert.False(t, bf.TestReader(bytes.NewReader(value)))
+	assert.Equal(t, uint64(1), bf.GetTotalInsertsCount())
+}
+
+func TestSetReader_Salted_MustMatchBytePath(t *testing.T) {
+	bf, err := NewBloomWithConfig(Config{Size: 64 * 64, Hashes: DefaultHashList, Salt: []byte("pepper")})
+	assert.NoError(t, err)
+	assert.NoError(t, bf.SetReader(bytes.NewReader([]byte("Hello"))))
+	assert.True(t, bf.Test([]byte("Hello")))
+}
+
+func TestSetReader_ExtendedHashes_MustMatchBytePath(t *testing.T) {
+	var keys = batchKeys(100)
+	var bf = FitFilter(keys, 0.001, DefaultHashList)
+	assert.Greater(t, bf.HashCount(), len(DefaultHashList))
+	for _, k := range keys {
+		assert.True(t, bf.TestReader(bytes.NewReader(k)))
+	}
+
+	// extending twice derives functions from derived ones
+	bf.ExtendHashesTo(bf.HashCount() + 3)
+	var value = []byte("Hello")
+	assert.NoError(t, bf.SetReader(bytes.NewReader(value)))
+	assert.True(t, bf.Test(value))
+	sums, err := bf.applyHashesReader(bytes.NewReader(value), bf.k, bf.derived, bf.doubleK)
+	assert.NoError(t, err)
+	assert.Equal(t, bf.applyHashes(value), sums)
+}
+
+func TestSetReader_CustomHash_MustFail(t *testing.T) {
+	var bf = NewBloom(64, func(b []byte) uint64 {
+		return 1
+	})
+	err := bf.SetReader(bytes.NewReader([]byte("Hello")))
+	assert.True(t, errors.Is(err, ErrNotStreamable))
+	assert.False(t, bf.TestReader(bytes.NewReader([]byte("Hello"))))
+}
@@ -0,0 +1,68 @@
+package bloomfilters
+
+// an immutable copy of the bits of a filter, valid as long as
+// the version of the filter hasn't moved past it
+type readView struct {
+	version uint64
+	bits    BitStore
+	k       []hashK
+	doubleK int
+}
+
+// once enabled, Test() and TestString() answer from a read-only copy of
+// the bit array without taking any lock, as long as the filter hasn't
+// changed since the copy was made. A lookup which finds its copy stale
+// takes the read lock as usual and refreshes the copy for the next ones.
+//
+// every refresh copies the whole bit array, so it only pays off for
+// filters which are mostly stable and queried at a high rate
+//
+// it only applies to a bit array in memory owned by the filter. A store
+// given to NewBloomWithStore() may be shared, e.g. through Redis, and the
+// writes of other filters to it would never invalidate the copy, so such
+// filters keep reading the store. A SparseBloom only uses copies once its
+// array is dense.
+func (b *Bloom) EnableSnapshotReads() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.snapshotReads = true
+}
+
+// returns the read view if there is one and it is up to date
+func (b *Bloom) currentView() *readView {
+	var v = b.view.Load()
+	if v != nil && v.version == b.version.Load() {
+		return v
+	}
+	return nil
+}
+
+// replaces a stale read view with a fresh copy of the bits. The caller
+// must hold at least the read lock, so no write happens during the copy;
+// concurrent callers leave the copying to a single one of them.
+func (b *Bloom) refreshView() {
+	if !b.snapshotReads || b.hashCount() == 0 || !b.ownsBits() {
+		return
+	}
+	var version = b.version.Load()
+	if v := b.view.Load(); v != nil && v.version == version {
+		return
+	}
+	if !b.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	defer b.refreshing.Store(false)
+	b.view.Store(&readView{version: version, bits: cloneWords(b.bitsmap), k: b.k, doubleK: b.doubleK})
+}
+
+// reports whether the bits only change through the filter itself, and
+// make a cheap copy; see EnableSnapshotReads()
+func (b *Bloom) ownsBits() bool {
+	switch s := b.bitsmap.(type) {
+	case memoryStore:
+		return true
+	case *sparseStore:
+		return s.dense != nil
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotReads_MustServeFromViewUntilChanged(t *testing.T) {
+	var bf = NewBloom(64*64, DefaultHashList...)
+	bf.EnableSnapshotReads()
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.Nil(t, bf.currentView())
+
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.NotNil(t, bf.currentView())
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.True(t, bf.TestString("Hello"))
+	assert.False(t, bf.Test([]byte("Bob")))
+
+	assert.NoError(t, bf.Set([]byte("Bob")))
+	assert.Nil(t, bf.currentView())
+	assert.True(t, bf.Test([]byte("Bob")))
+	assert.True(t, bf.TestString("Bob"))
+}
+
+func TestSnapshotReads_ExtendHashesTo_MustDropView(t *testing.T) {
+	var bf = NewBloomAuto(1000, 0.01)
+	bf.EnableSnapshotReads()
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.NotNil(t, bf.currentView())
+
+	bf.ExtendHashesTo(20)
+	assert.Nil(t, bf.currentView())
+	assert.False(t, bf.Test([]byte("Hello")))
+	assert.Equal(t, 20, bf.currentView().doubleK)
+
+	// nothing changes, the view stays
+	bf.ExtendHashesTo(10)
+	assert.NotNil(t, bf.currentView())
+}
+
+func TestSnapshotReads_Disabled_MustNotKeepView(t *testing.T) {
+	var bf = NewBloom(64*64, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.Nil(t, bf.currentView())
+}
+
+func TestSnapshotReads_ConcurrentMutation_MustNotMissInserted(t *testing.T) {
+	m, _ := OptimalValues(1200, 0.001)
+	var bf = NewBloom(m, DefaultHashList...)
+	bf.EnableSnapshotReads()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				var key = []byte(fmt.Sprintf("key-%d-%d", w, i))
+				assert.NoError(t, bf.Set(key))
+				// our own insert must be visible right away
+				assert.True(t, bf.Test(key))
+				assert.True(t, bf.TestString(string(key)))
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				bf.Test([]byte(fmt.Sprintf("key-0-%d", i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 300; i++ {
+			assert.True(t, bf.Test([]byte(fmt.Sprintf("key-%d-%d", w, i))))
+		}
+	}
+}
+
+func benchmarkParallelTest(b *testing.B, snapshots bool) {
+	m, _ := OptimalValues(100000, 0.001)
+	var bf = NewBloom(m, DefaultHashList...)
+	if snapshots {
+		bf.EnableSnapshotReads()
+	}
+	var keys = make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		bf.Set([]byte(keys[i]))
+	}
+	bf.Test([]byte(keys[0]))
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			bf.TestString(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func Benchmark_Bloom_ParallelTest_RLock(b *testing.B) {
+	benchmarkParallelTest(b, false)
+}
+
+func Benchmark_Bloom_ParallelTest_Snapshot(b *testing.B) {
+	benchmarkParallelTest(b, true)
+}
+
+func TestSnapshotReads_SharedStore_MustSeeOtherWriters(t *testing.T) {
+	var store = newMockStore(64)
+	a, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	b, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	b.EnableSnapshotReads()
+
+	assert.False(t, b.Test([]byte("Hello")))
+	assert.Nil(t, b.currentView())
+	assert.NoError(t, a.Set([]byte("Hello")))
+	assert.True(t, b.Test([]byte("Hello")))
+	assert.True(t, b.TestString("Hello"))
+}
+
+func TestSnapshotReads_Sparse_MustWaitForDense(t *testing.T) {
+	var sparse = NewSparseBloom(64*64, DefaultHashList...)
+	sparse.EnableSnapshotReads()
+	assert.NoError(t, sparse.Set([]byte("Hello")))
+	assert.True(t, sparse.Test([]byte("Hello")))
+	assert.Nil(t, sparse.currentView())
+
+	for n := 0; !sparse.IsDense(); n++ {
+		assert.NoError(t, sparse.Set([]byte(fmt.Sprintf("key-%d", n))))
+	}
+	assert.True(t, sparse.Test([]byte("Hello")))
+	assert.NotNil(t, sparse.currentView())
+	assert.True(t, sparse.Test([]byte("Hello")))
+}
@@ -0,0 +1,142 @@
+// Package redisstore keeps the bits of a filter in Redis, so several
+// processes share one filter, see Store.
+package redisstore
+
+import (
+	"context"
+	"encoding/binary"
+	"math/bits"
+	"sync"
+
+	"bloomfilters"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	_ bloomfilters.ContextBitStore = (*Store)(nil)
+	_ bloomfilters.BatchBitStore   = (*Store)(nil)
+)
+
+// Store is a bloomfilters.BitStore keeping the words of a filter in a Redis string, so several
+// processes building a filter on the same key share one set of bits.
+// Bit j of word i is the Redis bit at offset i*64 + 63 - j (Redis counts
+// from the most significant bit), so a word is GETRANGE's 8 bytes read
+// big endian. It is a bloomfilters.BatchBitStore, so Set(), SetMany(),
+// Test() and TestMany() each take a single pipelined round trip.
+//
+// consistency is eventual under concurrent writers: every bit is set
+// with its own atomic SETBIT, so another process may briefly see some
+// of the bits of a key being inserted but not all. The insert counter
+// of each Bloom only counts its own inserts, and filters on a Store never
+// answer from snapshot reads. The BitStore methods can't
+// return errors, so failed commands read as zero words and are reported
+// by Err().
+type Store struct {
+	client redis.Cmdable
+	key    string
+	words  uint64
+
+	mu  sync.Mutex
+	err error
+}
+
+// words is the number of words of the filter, i.e. its size in bits / 64.
+// Pass the store to bloomfilters.NewBloomWithStore() to build a filter on it.
+func New(client redis.Cmdable, key string, words uint64) *Store {
+	return &Store{client: client, key: key, words: words}
+}
+
+func (r *Store) GetWord(i uint64) uint64 {
+	var word, err = r.GetWordContext(context.Background(), i)
+	if err != nil {
+		r.setErr(err)
+	}
+	return word
+}
+
+// same as GetWord(), but the command is bound to ctx and its error is
+// returned instead of recorded, see Bloom.TestWithTimeout()
+func (r *Store) GetWordContext(ctx context.Context, i uint64) (uint64, error) {
+	var raw, err = r.client.GetRange(ctx, r.key, int64(i*8), int64(i*8+7)).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	return decodeWord(raw), nil
+}
+
+// reads every word of indices with a single pipelined round trip
+func (r *Store) GetWords(indices []uint64) []uint64 {
+	var ctx = context.Background()
+	var cmds = make([]*redis.StringCmd, len(indices))
+	var _, err = r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for n, i := range indices {
+			cmds[n] = p.GetRange(ctx, r.key, int64(i*8), int64(i*8+7))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		r.setErr(err)
+	}
+	var result = make([]uint64, len(indices))
+	for n, cmd := range cmds {
+		// a failed command reads as a zero word
+		if raw, err := cmd.Result(); err == nil {
+			result[n] = decodeWord(raw)
+		}
+	}
+	return result
+}
+
+// sets every bit of mask with a single pipelined round trip
+func (r *Store) SetBits(i uint64, mask uint64) {
+	r.SetWords(map[uint64]uint64{i: mask})
+}
+
+// sets every bit of every mask with a single pipelined round trip
+func (r *Store) SetWords(masks map[uint64]uint64) {
+	var ctx = context.Background()
+	var _, err = r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, mask := range masks {
+			for mask != 0 {
+				var j = uint64(bits.TrailingZeros64(mask))
+				p.SetBit(ctx, r.key, int64(i*64+63-j), 1)
+				mask &= mask - 1
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.setErr(err)
+	}
+}
+
+func (r *Store) Len() uint64 {
+	return r.words
+}
+
+func (r *Store) Reset() {
+	if err := r.client.Del(context.Background(), r.key).Err(); err != nil {
+		r.setErr(err)
+	}
+}
+
+// returns the last error a Redis command failed with, if any
+func (r *Store) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Store) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// the string may be shorter than a word, or empty, past the last set bit
+func decodeWord(raw string) uint64 {
+	var buf [8]byte
+	copy(buf[:], raw)
+	return binary.BigEndian.Uint64(buf[:])
+}
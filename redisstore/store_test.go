@@ -0,0 +1,148 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"bloomfilters"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns the address of the Redis server in BLOOM_REDIS_ADDR,
+// or of an in-process miniredis if it is unset
+func redisAddr(t *testing.T) string {
+	if addr := os.Getenv("BLOOM_REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return miniredis.RunT(t).Addr()
+}
+
+func TestStore_TwoClients_MustShareBits(t *testing.T) {
+	var addr = redisAddr(t)
+	var key = "bloomfilters-test:" + t.Name()
+	var writerClient = redis.NewClient(&redis.Options{Addr: addr})
+	var readerClient = redis.NewClient(&redis.Options{Addr: addr})
+	defer writerClient.Close()
+	defer readerClient.Close()
+	writerClient.Del(context.Background(), key)
+
+	writer, err := bloomfilters.NewBloomWithStore(New(writerClient, key, 256), bloomfilters.DefaultHashList...)
+	assert.NoError(t, err)
+	var readerStore = New(readerClient, key, 256)
+	reader, err := bloomfilters.NewBloomWithStore(readerStore, bloomfilters.DefaultHashList...)
+	assert.NoError(t, err)
+	// a copy of the bits would miss the inserts of the writer
+	reader.EnableSnapshotReads()
+
+	assert.False(t, reader.Test([]byte("Hello")))
+	assert.NoError(t, writer.Set([]byte("Hello")))
+	assert.NoError(t, writer.SetMany([][]byte{[]byte("Bob"), []byte("Sam")}))
+	assert.True(t, reader.Test([]byte("Hello")))
+	assert.True(t, reader.Test([]byte("Bob")))
+	assert.True(t, reader.TestString("Sam"))
+	assert.False(t, reader.Test([]byte("Joe")))
+	assert.NoError(t, readerStore.Err())
+
+	ok, err := reader.TestWithTimeout(context.Background(), []byte("Hello"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	reader.Reset()
+	assert.False(t, writer.Test([]byte("Hello")))
+}
+
+// counts the round trips a client makes, a pipeline being one
+type roundTrips struct {
+	n atomic.Int64
+}
+
+func (h *roundTrips) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.n.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.n.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+func TestStore_Batches_MustTakeOneRoundTrip(t *testing.T) {
+	var client = redis.NewClient(&redis.Options{Addr: redisAddr(t)})
+	defer client.Close()
+	var key = "bloomfilters-test:" + t.Name()
+	client.Del(context.Background(), key)
+	var trips = &roundTrips{}
+	client.AddHook(trips)
+
+	bf, err := bloomfilters.NewBloomWithStore(New(client, key, 256), bloomfilters.DefaultHashList...)
+	assert.NoError(t, err)
+	var keys = make([][]byte, 50)
+	for n := range keys {
+		keys[n] = fmt.Appendf(nil, "key-%d", n)
+	}
+
+	assert.NoError(t, bf.SetMany(keys))
+	assert.Equal(t, int64(1), trips.n.Swap(0))
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.Equal(t, int64(1), trips.n.Swap(0))
+
+	assert.Equal(t, slices.Repeat([]bool{true}, len(keys)), bf.TestMany(keys))
+	assert.Equal(t, int64(1), trips.n.Swap(0))
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.False(t, bf.TestString("Joe"))
+	assert.Equal(t, int64(2), trips.n.Swap(0))
+
+	// a snapshot copies every word in one go
+	var snapshot = bf.SnapshotAndReset()
+	assert.True(t, snapshot.Test([]byte("Hello")))
+	assert.Equal(t, int64(2), trips.n.Swap(0))
+}
+
+func TestStore_WordLayout_MustMatchMemory(t *testing.T) {
+	var client = redis.NewClient(&redis.Options{Addr: redisAddr(t)})
+	defer client.Close()
+	var key = "bloomfilters-test:" + t.Name()
+	client.Del(context.Background(), key)
+
+	var store = New(client, key, 4)
+	var words = make([]uint64, 4)
+	for _, set := range [][2]uint64{{0, 1}, {0, 1 << 63}, {2, 0xf0f0}, {3, 1 << 32}} {
+		store.SetBits(set[0], set[1])
+		words[set[0]] |= set[1]
+	}
+	for i, w := range words {
+		assert.Equal(t, w, store.GetWord(uint64(i)))
+	}
+	assert.Equal(t, []uint64{words[3], words[0], words[2]}, store.GetWords([]uint64{3, 0, 2}))
+	store.SetWords(map[uint64]uint64{1: 6, 2: 1})
+	assert.Equal(t, []uint64{6, 0xf0f1}, store.GetWords([]uint64{1, 2}))
+
+	// the first Redis bit is the most significant bit of word 0
+	bit, err := client.GetBit(context.Background(), key, 0).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), bit)
+	assert.NoError(t, store.Err())
+}
+
+func TestStore_Unreachable_MustReportErr(t *testing.T) {
+	var client = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	var store = New(client, "k", 1)
+	assert.Zero(t, store.GetWord(0))
+	assert.Error(t, store.Err())
+}
@@ -0,0 +1,54 @@
+package bloomfilters
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// prints the bit array as a grid of width bits per line, '#' for a set bit
+// and '.' for an unset one, from bit 0 of the first word onwards, up to the
+// last word a key can reach, see reachableWords()
+func (b *Bloom) RenderASCII(width int, w io.Writer) error {
+	if width < 1 {
+		return errors.New("width cannot be less than 1")
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	var out = bufio.NewWriter(w)
+	var bitCount = b.reachableWords() * 64
+	for i := uint64(0); i < bitCount; i++ {
+		var c byte = '.'
+		if (b.bitsmap.GetWord(i/64)>>(i%64))&1 == 1 {
+			c = '#'
+		}
+		out.WriteByte(c)
+		if (i+1)%uint64(width) == 0 || i+1 == bitCount {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Flush()
+}
+
+// encodes the bit array as a black and white PNG image with one pixel per
+// bit and one row per word a key can reach, set bits in black
+func (b *Bloom) RenderPNG(w io.Writer) error {
+	b.lock.RLock()
+	var rows = int(b.reachableWords())
+	var img = image.NewGray(image.Rect(0, 0, 64, rows))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < 64; x++ {
+			var c = color.White
+			if (b.bitsmap.GetWord(uint64(y))>>x)&1 == 1 {
+				c = color.Black
+			}
+			img.Set(x, y, c)
+		}
+	}
+	b.lock.RUnlock()
+	return png.Encode(w, img)
+}
@@ -0,0 +1,57 @@
+package bloomfilters
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderASCII_KnownBits_MustMatch(t *testing.T) {
+	var bf = NewBloomForBytes(16, Fnv1)
+	bf.setBits([]uint64{0, 3, 5, 63, 64, 127})
+
+	var out strings.Builder
+	assert.NoError(t, bf.RenderASCII(48, &out))
+	var expected = "#..#.#..........................................\n" +
+		"...............##...............................\n" +
+		"...............................#\n"
+	assert.Equal(t, expected, out.String())
+
+	assert.Error(t, bf.RenderASCII(0, &out))
+
+	// the two spare words of NewBloom() past size are printed too
+	bf = NewBloom(128, Fnv1)
+	bf.setBits([]uint64{2*64 + 1})
+	out.Reset()
+	assert.NoError(t, bf.RenderASCII(64, &out))
+	var lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, ".#"+strings.Repeat(".", 62), lines[2])
+}
+
+func TestRenderPNG_KnownBits_MustMatch(t *testing.T) {
+	var bf = NewBloom(128, Fnv1)
+	bf.setBits([]uint64{0, 3, 64 + 5, 2*64 + 7})
+
+	var buf bytes.Buffer
+	assert.NoError(t, bf.RenderPNG(&buf))
+	img, err := png.Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 64, img.Bounds().Dx())
+	// the two spare words of NewBloom() past size make rows too
+	assert.Equal(t, 4, img.Bounds().Dy())
+
+	var isSet = func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+	assert.True(t, isSet(0, 0))
+	assert.True(t, isSet(3, 0))
+	assert.False(t, isSet(1, 0))
+	assert.True(t, isSet(5, 1))
+	assert.False(t, isSet(0, 1))
+	assert.True(t, isSet(7, 2))
+}
@@ -0,0 +1,34 @@
+package bloomfilters
+
+import "fmt"
+
+// it holds one filter per shard and routes a key to the shards which
+// probably hold it, so only those need to be looked up downstream
+type ShardedIndex struct {
+	shards []*Bloom
+}
+
+// shards are addressed by their position in the list
+func NewShardedIndex(shards ...*Bloom) *ShardedIndex {
+	return &ShardedIndex{shards: shards}
+}
+
+func (s *ShardedIndex) AddToShard(shard int, d []byte) error {
+	if shard < 0 || shard >= len(s.shards) {
+		return fmt.Errorf("shard %d out of range [0, %d)", shard, len(s.shards))
+	}
+	return s.shards[shard].Set(d)
+}
+
+// returns, in ascending order, the shards whose filters report d as
+// present. The shard d was added to is always among them; others may
+// show up due to false positives.
+func (s *ShardedIndex) ProbableShards(d []byte) []int {
+	var result []int
+	for n, f := range s.shards {
+		if f.Test(d) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,28 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedIndex_MustRouteToOwningShard(t *testing.T) {
+	var index = NewShardedIndex(NewBloomAuto(1000, 0.001), NewBloomAuto(1000, 0.001), NewBloomAuto(1000, 0.001))
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, index.AddToShard(i%3, []byte(fmt.Sprintf("key-%d", i))))
+	}
+
+	var extra = 0
+	for i := 0; i < 3000; i++ {
+		var shards = index.ProbableShards([]byte(fmt.Sprintf("key-%d", i)))
+		assert.Contains(t, shards, i%3)
+		extra += len(shards) - 1
+	}
+	// false positive shards are allowed, but rare
+	assert.Less(t, extra, 30)
+
+	assert.Empty(t, index.ProbableShards([]byte("absent")))
+	assert.Error(t, index.AddToShard(3, []byte("Hello")))
+	assert.Error(t, index.AddToShard(-1, []byte("Hello")))
+}
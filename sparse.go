@@ -0,0 +1,98 @@
+package bloomfilters
+
+import "slices"
+
+// a filter whose bit array starts sparse: only its non-zero words are kept,
+// in sorted arrays, like a roaring bitmap's array containers. A word takes
+// 16 bytes this way instead of 8, but the zero ones take nothing, which for
+// a large filter holding few items is a small fraction of the dense array.
+//
+// once more than a quarter of the words are non-zero, the store converts
+// itself to the dense array for good: past that point the sparse form saves
+// less than half the memory while every new word shifts the arrays. It has
+// the API of a Bloom, the conversion is transparent.
+type SparseBloom struct {
+	*Bloom
+	store *sparseStore
+}
+
+// same as NewBloom(), but the bit array is sparse until it fills up,
+// and holds exactly size / 64 words
+func NewSparseBloom(size uint64, hashF ...hashK) *SparseBloom {
+	if size < 64 {
+		panic("size cannot be less than 64")
+	}
+	var store = &sparseStore{len: size / 64}
+	b, _ := NewBloomWithStore(store, hashF...)
+	return &SparseBloom{Bloom: b, store: store}
+}
+
+// reports whether the bit array has been converted to the dense form
+func (s *SparseBloom) IsDense() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.store.dense != nil
+}
+
+// a BitStore keeping the non-zero words and their indices in two sorted
+// arrays, until it turns to a memoryStore; see SparseBloom
+type sparseStore struct {
+	len     uint64
+	indices []uint64
+	words   []uint64
+	dense   memoryStore
+}
+
+func (s *sparseStore) GetWord(i uint64) uint64 {
+	if s.dense != nil {
+		return s.dense[i]
+	}
+	if n, ok := slices.BinarySearch(s.indices, i); ok {
+		return s.words[n]
+	}
+	return 0
+}
+
+func (s *sparseStore) SetBits(i uint64, mask uint64) {
+	if s.dense != nil {
+		s.dense[i] |= mask
+		return
+	}
+	n, ok := slices.BinarySearch(s.indices, i)
+	if ok {
+		s.words[n] |= mask
+		return
+	}
+	if mask == 0 {
+		return
+	}
+	s.indices = slices.Insert(s.indices, n, i)
+	s.words = slices.Insert(s.words, n, mask)
+	if uint64(len(s.indices)) > s.len/4 {
+		s.densify()
+	}
+}
+
+func (s *sparseStore) densify() {
+	s.dense = make(memoryStore, s.len)
+	for n, i := range s.indices {
+		s.dense[i] = s.words[n]
+	}
+	s.indices, s.words = nil, nil
+}
+
+func (s *sparseStore) Len() uint64 {
+	return s.len
+}
+
+// clears every word, going back to the sparse form
+func (s *sparseStore) Reset() {
+	s.indices, s.words, s.dense = nil, nil, nil
+}
+
+func (s *sparseStore) MemoryBytes() uint64 {
+	if s.dense != nil {
+		return s.dense.Len() * 8
+	}
+	return uint64(cap(s.indices)+cap(s.words)) * 8
+}
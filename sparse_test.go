@@ -0,0 +1,74 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseBloom_FewItems_MustTakeLittleMemory(t *testing.T) {
+	var sparse = NewSparseBloom(1<<20, DefaultHashList...)
+	dense, err := NewBloomWithBuffer(make([]uint64, 1<<20/64), DefaultHashList...)
+	assert.NoError(t, err)
+	assert.NoError(t, sparse.Validate())
+
+	for i := 0; i < 10; i++ {
+		var d = []byte(fmt.Sprintf("key-%d", i))
+		assert.NoError(t, sparse.Set(d))
+		assert.NoError(t, dense.Set(d))
+	}
+	assert.False(t, sparse.IsDense())
+	assert.Less(t, sparse.MemoryBytes()*50, dense.MemoryBytes())
+	for i := 0; i < 1000; i++ {
+		var d = []byte(fmt.Sprintf("key-%d", i))
+		assert.Equal(t, dense.Test(d), sparse.Test(d))
+	}
+}
+
+func TestSparseBloom_PastThreshold_MustConvertAndAnswer(t *testing.T) {
+	var sparse = NewSparseBloom(64*1024, DefaultHashList...)
+	dense, err := NewBloomWithBuffer(make([]uint64, 1024), DefaultHashList...)
+	assert.NoError(t, err)
+
+	var n = 0
+	for ; !sparse.IsDense(); n++ {
+		var d = []byte(fmt.Sprintf("key-%d", n))
+		assert.NoError(t, sparse.Set(d))
+		assert.NoError(t, dense.Set(d))
+	}
+	assert.Equal(t, dense.MemoryBytes(), sparse.MemoryBytes())
+	assert.Equal(t, cloneWords(dense.bitsmap), cloneWords(sparse.bitsmap))
+	for i := 0; i < n; i++ {
+		assert.True(t, sparse.Test([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.False(t, sparse.Test([]byte("Joe")))
+
+	sparse.Reset()
+	assert.False(t, sparse.IsDense())
+	assert.Zero(t, sparse.MemoryBytes())
+	assert.False(t, sparse.Test([]byte("key-0")))
+}
+
+func TestSparseBloom_ConcurrentMemoryBytes_MustNotRace(t *testing.T) {
+	var sparse = NewSparseBloom(64*1024, DefaultHashList...)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// past the conversion to dense
+		for n := 0; n < 2000; n++ {
+			assert.NoError(t, sparse.Set([]byte(fmt.Sprintf("key-%d", n))))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 2000; n++ {
+			assert.LessOrEqual(t, sparse.MemoryBytes(), uint64(1024*8))
+		}
+	}()
+	wg.Wait()
+	assert.True(t, sparse.IsDense())
+	assert.Equal(t, uint64(1024*8), sparse.MemoryBytes())
+}
@@ -0,0 +1,87 @@
+package bloomfilters
+
+import (
+	"math"
+	"math/bits"
+)
+
+// returns, per word index of a bit array of bitSize bits, how many bit-set
+// operations inserting keys with hashF would land in that word. A far from
+// uniform histogram reveals poor hashing or clustering in the index math.
+// bitSize rounds down to the nearest number divisible to 64, like NewBloom().
+func WordTouchHistogram(keys [][]byte, bitSize uint64, hashF []hashK) []uint64 {
+	if bitSize < 64 {
+		return nil
+	}
+	// only the geometry is needed, no bit array is allocated; without
+	// spare words past size, every index wraps into the histogram
+	var g = &Bloom{size: bitSize / 64, bitsize: bitSize - (bitSize % 64), bitsmap: memoryStore(nil), k: hashF}
+	var histogram = make([]uint64, g.size)
+	for _, key := range keys {
+		for _, sum := range g.applyHashes(key) {
+			mainIndex, _ := g.locate(sum)
+			histogram[mainIndex]++
+		}
+	}
+	return histogram
+}
+
+// returns the standard deviation of the number of set bits per word of the
+// bit array, divided by the mean. Evenly spread hash functions keep it low;
+// a high value means a few words take most of the load. It is zero for an
+// empty filter. The spare words a key can reach count as any other word,
+// see reachableWords().
+func (b *Bloom) WordLoadStdDev() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var counts = make([]float64, b.reachableWords())
+
+	var sum float64
+	for i := range counts {
+		counts[i] = float64(bits.OnesCount64(b.bitsmap.GetWord(uint64(i))))
+		sum += counts[i]
+	}
+	var mean = sum / float64(len(counts))
+	if mean == 0 {
+		return 0
+	}
+
+	var variance float64
+	for _, c := range counts {
+		var d = c - mean
+		variance += d * d
+	}
+	variance /= float64(len(counts))
+	return math.Sqrt(variance) / mean
+}
+
+// returns the fraction of the bits of the filter which are set, out of all
+// the bits a key can set, spare words included, see reachableWords()
+func (b *Bloom) FillRatio() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.fillRatio()
+}
+
+func (b *Bloom) fillRatio() float64 {
+	var set uint64
+	var words = b.reachableWords()
+	for i := range words {
+		set += uint64(bits.OnesCount64(b.bitsmap.GetWord(i)))
+	}
+	return float64(set) / float64(words*64)
+}
+
+// returns the Shannon entropy, in bits, of the bit array taken as as many
+// independent bits as FillRatio() counts, each set with that probability.
+// It bounds how small compression can make the array: a near empty or near
+// full filter takes a few bits, a half full one doesn't compress at all.
+func (b *Bloom) BitEntropy() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var p = b.fillRatio()
+	if p == 0 || p == 1 {
+		return 0
+	}
+	return float64(b.reachableWords()*64) * -(p*math.Log2(p) + (1-p)*math.Log2(1-p))
+}
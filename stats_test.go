@@ -0,0 +1,104 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordTouchHistogram_GoodHashes_MustBeUniform(t *testing.T) {
+	var keys = make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	// Fnv1 spreads sequential keys noticeably worse than Murmur3
+	var histogram = WordTouchHistogram(keys, 64*64, []hashK{Murmur3})
+	assert.Len(t, histogram, 64)
+
+	var total uint64
+	var expected = float64(len(keys)) / 64
+	for _, touches := range histogram {
+		total += touches
+		assert.InDelta(t, expected, float64(touches), expected*0.3)
+	}
+	assert.Equal(t, uint64(len(keys)), total)
+}
+
+func TestWordTouchHistogram_ConstantHash_MustLandInOneWord(t *testing.T) {
+	var keys = [][]byte{[]byte("Hello"), []byte("Bob"), []byte("Sam")}
+	var histogram = WordTouchHistogram(keys, 64*8, []hashK{func(b []byte) uint64 {
+		return 1
+	}})
+	assert.Equal(t, []uint64{3, 0, 0, 0, 0, 0, 0, 0}, histogram)
+	assert.Nil(t, WordTouchHistogram(keys, 63, DefaultHashList))
+}
+
+func TestWordLoadStdDev_GoodVersusConstantHash(t *testing.T) {
+	var good = NewBloom(64*64, Murmur3)
+	var constant = NewBloom(64*64, func(b []byte) uint64 {
+		return 1
+	})
+	assert.Zero(t, good.WordLoadStdDev())
+	for i := 0; i < 500; i++ {
+		var key = []byte(fmt.Sprintf("key-%d", i))
+		assert.NoError(t, good.Set(key))
+		assert.NoError(t, constant.Set(key))
+	}
+	assert.Less(t, good.WordLoadStdDev(), 0.6)
+	assert.Greater(t, constant.WordLoadStdDev(), 5.0)
+}
+
+func TestWordLoadStdDev_BitsInSpareWord_MustCount(t *testing.T) {
+	var bf = NewBloom(64*4, func(b []byte) uint64 {
+		return 4*64 + 5
+	})
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	// one loaded word out of six: mean 1/6, standard deviation √5/6
+	assert.InDelta(t, math.Sqrt(5), bf.WordLoadStdDev(), 1e-9)
+}
+
+func TestBitEntropy_MustPeakAtHalfFull(t *testing.T) {
+	var bf = NewBloom(64*256, DefaultHashList...)
+	assert.Zero(t, bf.FillRatio())
+	assert.Zero(t, bf.BitEntropy())
+
+	// n = m ln(2) / k inserts set about half of the bits
+	var n = int(float64(bf.bitsize) * math.Ln2 / 2)
+	for i := 0; i < n; i++ {
+		assert.NoError(t, bf.Set([]byte(fmt.Sprintf("key-%d", i))))
+	}
+	assert.InDelta(t, 0.5, bf.FillRatio(), 0.02)
+	// the two spare words of NewBloom() past size count too
+	var reachableBits = float64((bf.size + 2) * 64)
+	assert.InDelta(t, reachableBits, bf.BitEntropy(), reachableBits*0.01)
+
+	for i := range bf.size + 2 {
+		bf.bitsmap.SetBits(i, math.MaxUint64)
+	}
+	// words no key can reach are not part of the filter
+	bf.bitsmap.SetBits(bf.size+2, 1)
+	assert.Equal(t, float64(1), bf.FillRatio())
+	assert.Zero(t, bf.BitEntropy())
+}
+
+func TestFillRatio_BitInSpareWord_MustCount(t *testing.T) {
+	var bf = NewBloom(64*4, func(b []byte) uint64 {
+		return 4*64 + 5
+	})
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	assert.True(t, bf.Test([]byte("Hello")))
+	assert.Equal(t, 1.0/(6*64), bf.FillRatio())
+	assert.Positive(t, bf.BitEntropy())
+}
+
+func TestBitEntropy_QuarterFull_MustMatchFormula(t *testing.T) {
+	var bf = NewBloomForBytes(8*4, DefaultHashList...)
+	for i := range bf.size {
+		bf.bitsmap.SetBits(i, 0x1111111111111111)
+	}
+	assert.Equal(t, 0.25, bf.FillRatio())
+	// H(1/4) = 2 - 3/4 log2(3)
+	assert.InDelta(t, 256*(2-0.75*math.Log2(3)), bf.BitEntropy(), 1e-9)
+}
@@ -0,0 +1,186 @@
+package bloomfilters
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// BitStore holds the words of the bit array of a filter, so the same
+// filter logic can run against memory, a mapped file or a remote store.
+// Word i holds bits i*64 to i*64+63 of the array, bit 0 being the least
+// significant one of the word.
+type BitStore interface {
+	// returns the i-th word
+	GetWord(i uint64) uint64
+	// sets, in the i-th word, the bits set in mask
+	SetBits(i uint64, mask uint64)
+	// returns the number of words
+	Len() uint64
+	// clears every word
+	Reset()
+}
+
+// a BitStore whose reads can block, e.g. on the network, and so
+// take a context to give up on; see TestWithTimeout()
+type ContextBitStore interface {
+	BitStore
+	// same as GetWord(), but returns the error of ctx if it ends first
+	GetWordContext(ctx context.Context, i uint64) (uint64, error)
+}
+
+// a BitStore which reads and writes many words at once, e.g. in a single
+// round trip to a remote store. Filters give it every word an operation
+// touches in one call, instead of one call per word.
+type BatchBitStore interface {
+	BitStore
+	// returns the words at indices, in the same order
+	GetWords(indices []uint64) []uint64
+	// sets, in every word of masks, the bits set in its mask
+	SetWords(masks map[uint64]uint64)
+}
+
+// sets the bits of masks in s, with a single SetWords() call if s has it
+func setWords(s BitStore, masks map[uint64]uint64) {
+	if batch, ok := s.(BatchBitStore); ok {
+		batch.SetWords(masks)
+		return
+	}
+	for i, mask := range masks {
+		s.SetBits(i, mask)
+	}
+}
+
+// returns a reader of the words of s at the indices of every one of
+// indices. A BatchBitStore has them all fetched by a single GetWords()
+// call, other stores are read as the words are asked for.
+func wordsOf(s BitStore, indices ...IndexMap) func(uint64) uint64 {
+	var batch, ok = s.(BatchBitStore)
+	if !ok {
+		return s.GetWord
+	}
+	var wanted []uint64
+	for _, m := range indices {
+		for i := range m {
+			wanted = append(wanted, i)
+		}
+	}
+	slices.Sort(wanted)
+	wanted = slices.Compact(wanted)
+	var words = make(map[uint64]uint64, len(wanted))
+	for n, word := range batch.GetWords(wanted) {
+		words[wanted[n]] = word
+	}
+	return func(i uint64) uint64 {
+		return words[i]
+	}
+}
+
+// reads the i-th word of s, through GetWordContext() if s has it.
+// Other stores answer at once, ctx is only checked for being done.
+func getWordContext(ctx context.Context, s BitStore, i uint64) (uint64, error) {
+	if c, ok := s.(ContextBitStore); ok {
+		return c.GetWordContext(ctx, i)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.GetWord(i), nil
+}
+
+// the default BitStore, a plain slice of words in memory
+type memoryStore []uint64
+
+func (m memoryStore) GetWord(i uint64) uint64 {
+	return m[i]
+}
+
+func (m memoryStore) SetBits(i uint64, mask uint64) {
+	m[i] |= mask
+}
+
+func (m memoryStore) Len() uint64 {
+	return uint64(len(m))
+}
+
+func (m memoryStore) Reset() {
+	clear(m)
+}
+
+// returns an in-memory copy of the words of s
+func cloneWords(s BitStore) memoryStore {
+	if m, ok := s.(memoryStore); ok {
+		return slices.Clone(m)
+	}
+	var result = make(memoryStore, s.Len())
+	if batch, ok := s.(BatchBitStore); ok {
+		var indices = make([]uint64, len(result))
+		for i := range indices {
+			indices[i] = uint64(i)
+		}
+		copy(result, batch.GetWords(indices))
+		return result
+	}
+	for i := range result {
+		result[i] = s.GetWord(uint64(i))
+	}
+	return result
+}
+
+// builds a filter on top of store, whose Len() words make the size of the
+// filter. Unlike NewBloomWithBuffer(), the store is not cleared, as it may
+// already hold the bits of a filter shared with other processes.
+func NewBloomWithStore(store BitStore, hashF ...hashK) (*Bloom, error) {
+	if store == nil || store.Len() < 1 {
+		return nil, errors.New("store cannot be empty")
+	}
+
+	var b = &Bloom{}
+
+	b.size = store.Len()
+	b.bitsize = b.size * 64
+
+	b.bitsmap = store
+
+	b.k = hashF
+	b.probeErr = ProbeHashes(hashF...)
+
+	b.lock = &sync.RWMutex{}
+
+	return b, nil
+}
+
+// same as Test(), but gives up once ctx is done and returns its error,
+// instead of blocking on a store which never answers. It is only useful
+// with a ContextBitStore, like redisstore.Store; other stores answer at once.
+// Read views are not used.
+func (b *Bloom) TestWithTimeout(ctx context.Context, d []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.hashCount() == 0 {
+		panic("no hash function is defined")
+	}
+	var indices = b.findIndexPair(b.applyHashes(d))
+	if len(indices) == 0 {
+		return false, nil
+	}
+	for mainIndex, bitIndices := range indices {
+		word, err := getWordContext(ctx, b.bitsmap, mainIndex)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, bitIndex := range bitIndices {
+			if !assertBits(word, bitIndex, 1) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
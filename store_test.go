@@ -0,0 +1,235 @@
+package bloomfilters
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a map backed BitStore counting the calls it gets
+type mockStore struct {
+	mu    sync.Mutex
+	words map[uint64]uint64
+	len   uint64
+	gets  int
+	sets  int
+}
+
+func newMockStore(words uint64) *mockStore {
+	return &mockStore{words: make(map[uint64]uint64), len: words}
+}
+
+func (m *mockStore) GetWord(i uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gets++
+	return m.words[i]
+}
+
+func (m *mockStore) SetBits(i uint64, mask uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sets++
+	m.words[i] |= mask
+}
+
+func (m *mockStore) Len() uint64 {
+	return m.len
+}
+
+func (m *mockStore) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.words)
+}
+
+// a mockStore whose reads take delay, unless their context ends first
+type slowStore struct {
+	*mockStore
+	delay time.Duration
+}
+
+func (s *slowStore) GetWordContext(ctx context.Context, i uint64) (uint64, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.GetWord(i), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// a mockStore which also counts the calls of the BatchBitStore methods
+type batchStore struct {
+	*mockStore
+	batchGets int
+	batchSets int
+}
+
+func (s *batchStore) GetWords(indices []uint64) []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchGets++
+	var result = make([]uint64, len(indices))
+	for n, i := range indices {
+		result[n] = s.words[i]
+	}
+	return result
+}
+
+func (s *batchStore) SetWords(masks map[uint64]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchSets++
+	for i, mask := range masks {
+		s.words[i] |= mask
+	}
+}
+
+// makes a BitStore of words words
+type storeFactory = func(words uint64) BitStore
+
+// runs test once per kind of store, as a subtest named after it
+func forEachStore(t *testing.T, test func(t *testing.T, newStore storeFactory)) {
+	var stores = []struct {
+		name     string
+		newStore storeFactory
+	}{
+		{"memory", func(words uint64) BitStore { return make(memoryStore, words) }},
+		{"mock", func(words uint64) BitStore { return newMockStore(words) }},
+		{"batch", func(words uint64) BitStore { return &batchStore{mockStore: newMockStore(words)} }},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			test(t, s.newStore)
+		})
+	}
+}
+
+// same as NewBloom(), but the bit array, as many words long, is made by
+// newStore
+func newBloomOnStore(newStore storeFactory, size uint64, hashF ...hashK) *Bloom {
+	var b = NewBloom(size, hashF...)
+	b.bitsmap = newStore(b.bitsmap.Len())
+	return b
+}
+
+func TestNewBloomWithStore_MockStore_MustAnswerMembership(t *testing.T) {
+	var store = newMockStore(1000)
+	bf, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	assert.NoError(t, bf.Validate())
+	var reference = NewBloomForBytes(1000*8, DefaultHashList...)
+
+	var keys = batchKeys(300)
+	for _, k := range keys[:100] {
+		assert.NoError(t, bf.Set(k))
+		assert.NoError(t, reference.Set(k))
+	}
+	assert.NoError(t, bf.SetMany(keys[100:200]))
+	assert.NoError(t, reference.SetMany(keys[100:200]))
+	assert.Positive(t, store.sets)
+
+	for _, k := range keys[:200] {
+		assert.True(t, bf.Test(k))
+		assert.True(t, bf.TestString(string(k)))
+	}
+	assert.Equal(t, reference.TestMany(keys), bf.TestMany(keys))
+	assert.Equal(t, reference.KeyFootprint(keys[0]), bf.KeyFootprint(keys[0]))
+	assert.Positive(t, store.gets)
+
+	var snapshot = bf.SnapshotAndReset()
+	assert.Empty(t, store.words)
+	assert.True(t, snapshot.Test(keys[0]))
+	assert.False(t, bf.Test(keys[0]))
+	assert.Equal(t, cloneWords(reference.bitsmap), snapshot.bitsmap)
+}
+
+func TestNewBloomWithStore_BatchStore_MustBatchEveryOperation(t *testing.T) {
+	var store = &batchStore{mockStore: newMockStore(1000)}
+	bf, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	var keys = batchKeys(100)
+
+	assert.NoError(t, bf.Set(keys[0]))
+	assert.NoError(t, bf.SetMany(keys[1:]))
+	assert.Equal(t, 2, store.batchSets)
+	assert.Equal(t, uint64(100), bf.GetTotalInsertsCount())
+
+	assert.True(t, bf.Test(keys[0]))
+	assert.True(t, bf.TestString(string(keys[1])))
+	assert.Equal(t, slices.Repeat([]bool{true}, 100), bf.TestMany(keys))
+	assert.Equal(t, 3, store.batchGets)
+
+	var snapshot = bf.SnapshotAndReset()
+	assert.True(t, snapshot.Test(keys[0]))
+	assert.Equal(t, 4, store.batchGets)
+	assert.Zero(t, store.gets)
+	assert.Zero(t, store.sets)
+}
+
+func TestNewBloomWithStore_MustNotClearStore(t *testing.T) {
+	var store = newMockStore(64)
+	first, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	assert.NoError(t, first.Set([]byte("Hello")))
+
+	// a second filter on the same store sees the bits of the first
+	second, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	assert.True(t, second.Test([]byte("Hello")))
+
+	_, err = NewBloomWithStore(newMockStore(0), DefaultHashList...)
+	assert.Error(t, err)
+	_, err = NewBloomWithStore(nil, DefaultHashList...)
+	assert.Error(t, err)
+}
+
+func TestCloneWords_MustCopy(t *testing.T) {
+	var m = memoryStore{1, 2, 3}
+	var c = cloneWords(m)
+	c.SetBits(0, 4)
+	assert.Equal(t, uint64(1), m.GetWord(0))
+
+	var store = newMockStore(3)
+	store.SetBits(1, 8)
+	assert.Equal(t, memoryStore{0, 8, 0}, cloneWords(store))
+}
+
+func TestTestWithTimeout_SlowStore_MustReturnDeadlineExceeded(t *testing.T) {
+	var store = &slowStore{mockStore: newMockStore(64), delay: time.Hour}
+	bf, err := NewBloomWithStore(store, DefaultHashList...)
+	assert.NoError(t, err)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	ok, err := bf.TestWithTimeout(ctx, []byte("Hello"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, ok)
+	assert.Less(t, time.Since(start), time.Second)
+
+	store.delay = 0
+	ok, err = bf.TestWithTimeout(context.Background(), []byte("Hello"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestTestWithTimeout_MemoryStore_MustMatchTest(t *testing.T) {
+	var bf = NewBloom(1000, DefaultHashList...)
+	assert.NoError(t, bf.Set([]byte("Hello")))
+	for _, k := range []string{"Hello", "Joe", ""} {
+		ok, err := bf.TestWithTimeout(context.Background(), []byte(k))
+		assert.NoError(t, err)
+		assert.Equal(t, bf.Test([]byte(k)), ok)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := bf.TestWithTimeout(ctx, []byte("Hello"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,75 @@
+package bloomfilters
+
+// HashStrategy is how a filter derives the bit positions of a key
+type HashStrategy int
+
+const (
+	// one call to a hash function per position, see NewBloom()
+	DirectHashing HashStrategy = iota
+	// every position derived from a single 128-bit murmur3 sum,
+	// see NewBloomAuto()
+	DoubleHashing
+	// distinct positions derived from a single hash sum,
+	// see NewBloomDistinctBits()
+	DistinctHashing
+)
+
+func (s HashStrategy) String() string {
+	switch s {
+	case DirectHashing:
+		return "direct"
+	case DoubleHashing:
+		return "double"
+	case DistinctHashing:
+		return "distinct"
+	}
+	return "unknown"
+}
+
+// the cost model of RecommendHashStrategy(), in nanoseconds, measured on
+// murmur3 calls, see Benchmark_Bloom_HashStrategy: a hash call costs a
+// fixed amount plus an amount per byte of key, the 128-bit sum of double
+// hashing a little more than a 64-bit one, and deriving a position from
+// it next to nothing
+const (
+	hashCallNanos    = 8.0
+	hash128CallNanos = 9.0
+	hashByteNanos    = 0.17
+	positionNanos    = 1.0
+)
+
+// returns the cheaper strategy for hashing a key of sampleKeyLen bytes
+// into k positions, according to the cost model above:
+//
+//	direct: k * (hashCallNanos + hashByteNanos*L)
+//	double: hash128CallNanos + hashByteNanos*L + k*positionNanos
+//
+// by these costs double hashing is cheaper from k = 2 on, whatever the
+// length of the key, and direct hashing for a single position. Ties go to
+// direct hashing, which keeps the independence of the functions supplied.
+func RecommendHashStrategy(sampleKeyLen int, k int) HashStrategy {
+	var keyNanos = hashByteNanos * float64(max(sampleKeyLen, 0))
+	var direct = float64(k) * (hashCallNanos + keyNanos)
+	var double = hash128CallNanos + keyNanos + float64(k)*positionNanos
+	if direct > double {
+		return DoubleHashing
+	}
+	return DirectHashing
+}
+
+// returns the strategy the filter derives its bit positions with
+func (b *Bloom) HashStrategy() HashStrategy {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.hashStrategy()
+}
+
+func (b *Bloom) hashStrategy() HashStrategy {
+	if b.distinctBits > 0 {
+		return DistinctHashing
+	}
+	if b.doubleK > 0 {
+		return DoubleHashing
+	}
+	return DirectHashing
+}
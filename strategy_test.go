@@ -0,0 +1,54 @@
+package bloomfilters
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendHashStrategy_MustPickTheCheaper(t *testing.T) {
+	assert.Equal(t, DoubleHashing, RecommendHashStrategy(512, 8))
+	assert.Equal(t, DoubleHashing, RecommendHashStrategy(64, 7))
+	assert.Equal(t, DoubleHashing, RecommendHashStrategy(8, 10))
+	// 11.68ns against 17.36ns
+	assert.Equal(t, DoubleHashing, RecommendHashStrategy(4, 2))
+
+	assert.Equal(t, DirectHashing, RecommendHashStrategy(32, 1))
+	// a single position is never cheaper derived from a 128-bit sum
+	assert.Equal(t, DirectHashing, RecommendHashStrategy(4096, 1))
+	assert.Equal(t, DirectHashing, RecommendHashStrategy(0, 0))
+}
+
+func TestHashStrategy_MustReportConstructor(t *testing.T) {
+	assert.Equal(t, DirectHashing, NewBloom(64, DefaultHashList...).HashStrategy())
+	assert.Equal(t, DoubleHashing, NewBloomAuto(100, 0.01).HashStrategy())
+	assert.Equal(t, "double", DoubleHashing.String())
+}
+
+// measures the hashing behind the cost model of RecommendHashStrategy();
+// each direct position is a murmur3 call
+func Benchmark_Bloom_HashStrategy(b *testing.B) {
+	for _, keyLen := range []int{8, 64, 512} {
+		for _, k := range []int{1, 2, 4, 8} {
+			var d = make([]byte, keyLen)
+			var hashes = make([]hashK, k)
+			for i := range hashes {
+				hashes[i] = Murmur3
+			}
+			var direct = NewBloom(64, hashes...)
+			var double = NewBloom(64)
+			double.doubleK = k
+			b.Run(fmt.Sprintf("direct/len=%d/k=%d", keyLen, k), func(b *testing.B) {
+				for b.Loop() {
+					direct.applyHashes(d)
+				}
+			})
+			b.Run(fmt.Sprintf("double/len=%d/k=%d", keyLen, k), func(b *testing.B) {
+				for b.Loop() {
+					double.applyHashes(d)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package bloomfilters
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// repeatedly hashes random keys of keyLen bytes through every function of
+// hashF for about duration and returns how many keys per second went
+// through the whole list. It lets users compare DefaultHashList against
+// alternatives on their own hardware, at runtime, without a benchmark.
+// It returns zero for a negative keyLen.
+func MeasureThroughput(hashF []hashK, duration time.Duration, keyLen int) (opsPerSec float64) {
+	if len(hashF) == 0 || duration <= 0 || keyLen < 0 {
+		return 0
+	}
+	// keys are generated up front, so only hashing is measured
+	var keys = make([][]byte, 1024)
+	for n := range keys {
+		keys[n] = make([]byte, keyLen)
+		for i := range keys[n] {
+			keys[n][i] = byte(rand.Uint32())
+		}
+	}
+
+	var ops uint64
+	var sink uint64
+	var start = time.Now()
+	var elapsed time.Duration
+	for elapsed < duration {
+		// checked after every key, so a slow hash doesn't overshoot
+		// duration by a whole pass over keys
+		for _, key := range keys {
+			for _, h := range hashF {
+				sink ^= h(key)
+			}
+			ops++
+			if elapsed = time.Since(start); elapsed >= duration {
+				break
+			}
+		}
+	}
+	_ = sink
+	return float64(ops) / elapsed.Seconds()
+}
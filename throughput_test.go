@@ -0,0 +1,37 @@
+package bloomfilters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureThroughput_DefaultHashList(t *testing.T) {
+	var start = time.Now()
+	var ops = MeasureThroughput(DefaultHashList, 50*time.Millisecond, 32)
+	var elapsed = time.Since(start)
+
+	assert.Positive(t, ops)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	assert.Less(t, elapsed, 500*time.Millisecond)
+
+	assert.Zero(t, MeasureThroughput(nil, 50*time.Millisecond, 32))
+	assert.Zero(t, MeasureThroughput(DefaultHashList, 0, 32))
+	assert.Zero(t, MeasureThroughput(DefaultHashList, 50*time.Millisecond, -1))
+	assert.Positive(t, MeasureThroughput(DefaultHashList, time.Millisecond, 0))
+}
+
+func TestMeasureThroughput_SlowHash_MustStopNearDuration(t *testing.T) {
+	var slow = func(b []byte) uint64 {
+		time.Sleep(time.Millisecond)
+		return Murmur3(b)
+	}
+	var start = time.Now()
+	var ops = MeasureThroughput([]hashK{slow}, 20*time.Millisecond, 8)
+	var elapsed = time.Since(start)
+
+	assert.Positive(t, ops)
+	// a full pass over the keys would take more than a second
+	assert.Less(t, elapsed, 200*time.Millisecond)
+}
@@ -0,0 +1,49 @@
+package bloomfilters
+
+import "encoding/binary"
+
+// turns a key of type T into the bytes it is hashed as. Two keys
+// with the same encoding are the same key to the filter.
+type KeyCodec[T any] func(T) []byte
+
+// it wraps a filter to insert and test keys of type T directly, through
+// a codec, instead of converting them to []byte at every call site
+type TypedBloom[T any] struct {
+	bloom *Bloom
+	codec KeyCodec[T]
+}
+
+func NewTypedBloom[T any](b *Bloom, codec KeyCodec[T]) *TypedBloom[T] {
+	return &TypedBloom[T]{bloom: b, codec: codec}
+}
+
+func (t *TypedBloom[T]) Add(v T) error {
+	return t.bloom.Set(t.codec(v))
+}
+
+func (t *TypedBloom[T]) Contains(v T) bool {
+	return t.bloom.Test(t.codec(v))
+}
+
+// returns the wrapped filter
+func (t *TypedBloom[T]) Bloom() *Bloom {
+	return t.bloom
+}
+
+func StringCodec(v string) []byte {
+	return []byte(v)
+}
+
+// encodes v as 8 little endian bytes, whatever the size of int
+func IntCodec(v int) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(v))
+}
+
+// encodes v as 8 little endian bytes
+func Uint64Codec(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
+}
+
+func BytesCodec(v []byte) []byte {
+	return v
+}
@@ -0,0 +1,44 @@
+package bloomfilters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedBloom_Int_MustAnswerMembership(t *testing.T) {
+	var tb = NewTypedBloom(NewBloomAuto(1000, 0.001), IntCodec)
+	for i := 0; i < 1000; i += 2 {
+		assert.NoError(t, tb.Add(i))
+	}
+	for i := 0; i < 1000; i += 2 {
+		assert.True(t, tb.Contains(i))
+	}
+	assert.False(t, tb.Contains(-1))
+	assert.Equal(t, uint64(500), tb.Bloom().GetTotalInsertsCount())
+
+	// same encoding as the uint64 codec
+	var tu = NewTypedBloom(tb.Bloom(), Uint64Codec)
+	assert.True(t, tu.Contains(2))
+}
+
+func TestTypedBloom_String_MustAnswerMembership(t *testing.T) {
+	var ts = NewTypedBloom(NewBloomAuto(100, 0.001), StringCodec)
+	assert.NoError(t, ts.Add("Hello"))
+	assert.True(t, ts.Contains("Hello"))
+	assert.False(t, ts.Contains("Bob"))
+
+	var tb = NewTypedBloom(ts.Bloom(), BytesCodec)
+	assert.True(t, tb.Contains([]byte("Hello")))
+}
+
+func TestTypedBloom_SameEncoding_MustCollide(t *testing.T) {
+	var caseless = func(v string) []byte {
+		return []byte(strings.ToLower(v))
+	}
+	var ts = NewTypedBloom(NewBloomAuto(100, 0.001), caseless)
+	assert.NoError(t, ts.Add("Hello"))
+	assert.True(t, ts.Contains("HELLO"))
+	assert.True(t, ts.Contains("hello"))
+}